@@ -1,254 +1,328 @@
 package autobot
 
 import (
+	"context"
+	"fmt"
+	"github.com/coveo/uabot-server/eventsink"
 	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/coveo/uabot-server/logging"
+	"github.com/coveo/uabot-server/metrics"
 	"github.com/coveo/uabot/scenariolib"
 	"math/rand"
+	"strings"
 	"time"
 )
 
 type Autobot struct {
-	config *explorerlib.Config
-	random *rand.Rand
+	config        *explorerlib.Config
+	random        *rand.Rand
+	phaseListener func(phase Phase)
+	progress      explorerlib.ProgressReporter
+	vocabularies  *explorerlib.VocabularyCache
+	logger        *logging.Logger
+	rateLimiters  *explorerlib.RateLimiters
+	retryPolicy   explorerlib.RetryPolicy
+
+	// queryReportListener receives the report of the query building
+	queryReportListener func(reports []explorerlib.LanguageQueryReport)
+	// targetCounts are what the bot sent toward its target before it was resumed
+	targetCounts   explorerlib.TargetCounts
+	targetListener func(counts explorerlib.TargetCounts)
 }
 
-func NewAutobot(_config *explorerlib.Config, _random *rand.Rand) *Autobot {
+// Phase is the step of the run the bot is currently in
+type Phase string
+
+const (
+	EXPLORING       Phase = "exploring"
+	BUILDINGQUERIES Phase = "building-queries"
+	RUNNING         Phase = "running"
+
+	// TARGETREPORTINTERVAL is how often a bot with a target reports what it sent
+	TARGETREPORTINTERVAL time.Duration = 10 * time.Second
+)
+
+// NewAutobot creates a bot with a random of its own, seeded with the seed of
+// the configuration when it has one.
+func NewAutobot(_config *explorerlib.Config) *Autobot {
+	seed := time.Now().UnixNano()
+	if _config.Seed != nil {
+		seed = *_config.Seed
+	}
 	return &Autobot{
-		config: _config,
-		random: _random,
+		config:              _config,
+		random:              rand.New(rand.NewSource(seed)),
+		phaseListener:       func(phase Phase) {},
+		queryReportListener: func(reports []explorerlib.LanguageQueryReport) {},
+		targetListener:      func(counts explorerlib.TargetCounts) {},
+		progress:            explorerlib.NopProgressReporter(),
+		logger:              logging.ForJob(_config.Id.String(), _config.Org),
+		retryPolicy:         explorerlib.DefaultRetryPolicy(),
 	}
 }
 
-const (
-	MINIMUMINDEXCALLTIME time.Duration = 200 //Base value to throttle down Index queries in Milliseconds
-)
+// OnPhaseChange registers a function called every time the bot enters a new phase
+func (bot *Autobot) OnPhaseChange(listener func(phase Phase)) {
+	bot.phaseListener = listener
+}
+
+// OnQueryReport registers a function called with the report of every language once the queries are built
+func (bot *Autobot) OnQueryReport(listener func(reports []explorerlib.LanguageQueryReport)) {
+	bot.queryReportListener = listener
+}
+
+// OnTargetCounts registers a function called regularly with what a bot with a
+// target sent, and once more when it stops.
+func (bot *Autobot) OnTargetCounts(listener func(counts explorerlib.TargetCounts)) {
+	bot.targetListener = listener
+}
+
+// ResumeTarget counts what the bot sent before it was paused or the server restarted toward its target
+func (bot *Autobot) ResumeTarget(counts explorerlib.TargetCounts) {
+	bot.targetCounts = counts
+}
+
+// ReportProgressTo sets where the bot reports the progress of the exploration and query building
+func (bot *Autobot) ReportProgressTo(progress explorerlib.ProgressReporter) {
+	bot.progress = progress
+}
+
+// UseLogger sets the logger of the bot, it is tagged with the phase of the bot as it runs
+func (bot *Autobot) UseLogger(logger *logging.Logger) {
+	bot.logger = logger
+}
+
+func (bot *Autobot) enterPhase(phase Phase) {
+	bot.logger = bot.logger.WithPhase(string(phase))
+	bot.phaseListener(phase)
+}
+
+// UseRateLimiters limits the queries the bot sends to the index, shared with the other bots querying the same org
+func (bot *Autobot) UseRateLimiters(rateLimiters *explorerlib.RateLimiters) {
+	bot.rateLimiters = rateLimiters
+}
 
-func (bot *Autobot) Run(quitChannel chan bool) error {
-	scenariolib.Info.Print("Creating Index")
-	index, status := explorerlib.NewIndex(bot.config.SearchEndpoint, bot.config.SearchToken)
-	scenariolib.Info.Print("Determining Words count per language")
-	wordCountsByLanguage, status := explorerlib.FindWordsByLanguageInIndex(
+// UseRetryPolicy sets the timeout of the queries sent to the index and how they are retried
+func (bot *Autobot) UseRetryPolicy(policy explorerlib.RetryPolicy) {
+	bot.retryPolicy = policy
+}
+
+// UseVocabularyCache lets the bot reuse the words found by a previous exploration of the same index
+func (bot *Autobot) UseVocabularyCache(vocabularies *explorerlib.VocabularyCache) {
+	bot.vocabularies = vocabularies
+}
+
+func (bot *Autobot) findWordsByLanguage(ctx context.Context, index explorerlib.Index) (map[string]explorerlib.WordCounts, error) {
+	key := explorerlib.NewVocabularyKey(bot.config)
+	// a bot recording or replaying its searches explores the index, its vocabulary is not cached
+	archived := bot.config.SearchArchiveMode != ""
+	if bot.vocabularies != nil && !bot.config.RefreshVocabulary && !archived {
+		if vocabulary, ok := bot.vocabularies.Get(key); ok {
+			bot.logger.Infof("Using vocabulary %v discovered on %v", key.Id(), vocabulary.CreationTime)
+			return vocabulary.WordCountsByLanguage, nil
+		}
+	}
+	bot.logger.Infof("Determining Words count per language")
+	start := time.Now()
+	wordCountsByLanguage, err := explorerlib.FindWordsByLanguageInIndex(
+		ctx,
 		index,
+		bot.random,
 		bot.config.FieldsToExploreEqually,
 		bot.config.DocumentsExplorationPercentage,
 		bot.config.FetchNumberOfResults,
-		MINIMUMINDEXCALLTIME)
+		bot.progress,
+		bot.logger)
+	if err != nil {
+		metrics.Errors.WithLabelValues(metrics.EXPLORERROR).Inc()
+		return nil, err
+	}
+	metrics.ExplorationDuration.WithLabelValues(bot.config.Org).Observe(time.Since(start).Seconds())
+	if bot.vocabularies != nil && !archived {
+		err = bot.vocabularies.Save(key, wordCountsByLanguage)
+		if err != nil {
+			bot.logger.Warningf("Cannot save vocabulary %v : %v", key.Id(), err)
+		}
+	}
+	return wordCountsByLanguage, nil
+}
+
+// Run plans the bot then sends analytics until the context is done, a bot
+// configured to only plan stops after saving its uabot configuration.
+func (bot *Autobot) Run(ctx context.Context) error {
+	var err error
+	if bot.config.UabotConfig != nil {
+		err = explorerlib.SaveUabotConfig(bot.config.UabotConfig, bot.config.OutputFilePath)
+	} else {
+		err = bot.Plan(ctx)
+	}
+	if err != nil || bot.config.PlanOnly {
+		return err
+	}
+
+	var sink eventsink.Sink
+	if bot.config.EventSink != "" && bot.config.EventSink != eventsink.COVEO {
+		sink, err = eventsink.Open(bot.config.EventSink, bot.config.EventsFilePath)
+		if err != nil {
+			return err
+		}
+		bot.logger.Infof("Writing the analytics events to %v", bot.config.EventSink)
+	}
+	// uabot is given a token of the job, its visits find the sink, the random
+	// and the traffic pacer of the bot with it
+	analyticsToken := eventsink.Register(bot.config.Id.String(), bot.config.Org, sink, string(bot.config.AnalyticsToken))
+	setVisitRandom(analyticsToken, bot.random)
+	paced := bot.newVisitPacer(ctx)
+	if paced != nil {
+		setVisitPacer(analyticsToken, paced)
+	}
+	defer func() {
+		setVisitRandom(analyticsToken, nil)
+		setVisitPacer(analyticsToken, nil)
+		err := eventsink.Unregister(analyticsToken)
+		if err != nil {
+			bot.logger.Warningf("Cannot close the %v event sink : %v", bot.config.EventSink, err)
+		}
+	}()
+	uabot := scenariolib.NewUabot(true, bot.config.OutputFilePath, string(bot.config.SearchToken), analyticsToken, bot.random)
+
+	bot.enterPhase(RUNNING)
+	bot.logger.Infof("Running Bot")
+	var target *explorerlib.TargetPacer
+	if paced != nil {
+		target = paced.target
+	}
+	quitChannel := make(chan bool)
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		// both stay nil, and block, for a bot without a target
+		var reached <-chan bool
+		var tick <-chan time.Time
+		if target != nil {
+			reached = target.Reached()
+			ticker := time.NewTicker(TARGETREPORTINTERVAL)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				close(quitChannel)
+				return
+			case <-reached:
+				// uabot stops after the visit in progress
+				bot.logger.Infof("Target reached, stopping after the current visit")
+				close(quitChannel)
+				return
+			case <-tick:
+				bot.targetListener(target.Counts())
+			case <-done:
+				return
+			}
+		}
+	}()
+	err = uabot.Run(quitChannel)
+	if target != nil {
+		bot.targetListener(target.Counts())
+	}
+	return err
+}
+
+// newVisitPacer paces the visits of a bot with a traffic profile or a
+// target, it returns nil for a bot visiting as fast as it can.
+func (bot *Autobot) newVisitPacer(ctx context.Context) *visitPacer {
+	profile, target := bot.config.TrafficProfile, bot.config.Target
+	if profile == nil && target == nil {
+		return nil
+	}
+	paced := &visitPacer{ctx: ctx}
+	now := time.Now()
+	if target != nil {
+		// a budget without a rate is spread until the time to live runs out
+		deadline, _ := ctx.Deadline()
+		paced.target = explorerlib.NewTargetPacer(target, bot.targetCounts, now, deadline)
+		paced.pacer = paced.target
+		bot.logger.Infof("Target of the bot %+v, already sent %v visits and %v events", *target, bot.targetCounts.Visits, bot.targetCounts.Events)
+	}
+	if profile != nil {
+		// the traffic profile spaces the visits of a bot with a budget
+		paced.pacer = explorerlib.NewTrafficPacer(profile, bot.random, now)
+		bot.logger.Infof("Pacing the visits with the %v traffic profile, %v visits per hour at its peak", profile.Preset, profile.VisitsPerHour)
+	}
+	return paced
+}
+
+// Plan explores the index, builds the queries and scenarios and saves the
+// uabot configuration to the output file path, it stops as soon as the
+// context is done.
+func (bot *Autobot) Plan(ctx context.Context) error {
+	bot.enterPhase(EXPLORING)
+	bot.logger.Infof("Creating Index")
+	index, closeArchive, status := bot.newIndex()
+	if status != nil {
+		return status
+	}
+	defer func() {
+		err := closeArchive()
+		if err != nil {
+			bot.logger.Warningf("Cannot save the search archive %v : %v", bot.config.SearchArchivePath, err)
+		}
+	}()
+	wordCountsByLanguage, status := bot.findWordsByLanguage(ctx, index)
 	if status != nil {
 		return status
 	}
 
-	languages, status := index.Client.ListFacetValues("@language", 1000)
+	languages, status := index.Client.ListFacetValues(ctx, "@language", 1000)
 	if status != nil {
 		return status
 	}
-	scenariolib.Info.Print("Creating Queries")
-	goodQueries, status := index.BuildGoodQueries(
+	bot.enterPhase(BUILDINGQUERIES)
+	bot.logger.Infof("Creating Queries")
+	goodQueries, queryReports, status := index.BuildGoodQueries(
+		ctx,
+		bot.random,
 		wordCountsByLanguage,
 		bot.config.NumberOfQueryByLanguage,
+		bot.config.QueryAttemptsPerLanguage,
 		bot.config.AverageNumberOfWordsPerQuery,
-		MINIMUMINDEXCALLTIME,
-		bot.config.Id)
+		bot.progress,
+		bot.logger)
 	if status != nil {
 		return status
 	}
+	dropped, status := dropLanguagesUnderMinimum(queryReports, bot.config.MinimumQueriesPerLanguage)
+	bot.queryReportListener(queryReports)
+	if status != nil {
+		return status
+	}
+	for language := range dropped {
+		bot.logger.Warningf("Dropping language %v, fewer than %v queries found", language, bot.config.MinimumQueriesPerLanguage)
+		delete(goodQueries, language)
+	}
 
 	taggedLanguages := make([]string, 0)
 	scenarios := []*scenariolib.Scenario{}
 
 	originLevels := bot.config.OriginLevels
 
-	scenariolib.Info.Print("Creating scenarios")
+	templates := bot.config.Scenarios
+	if len(templates) == 0 {
+		templates = explorerlib.DefaultScenarioTemplates()
+	}
+
+	bot.logger.Infof("Creating scenarios")
 	for originLevel1, originLevels2 := range originLevels {
 		for _, originLevel2 := range originLevels2 {
 			for _, lang := range languages.Values {
-				taggedLanguage := explorerlib.LanguageToTag(lang.Value)
-				taggedLanguages = append(taggedLanguages, taggedLanguage)
-
-				//Five scenarios with 1 to 5 search and a click event
-				scenario := explorerlib.NewScenarioBuilder().
-					WithName("1 search and click in " + lang.Value).
-					WithWeight(lang.NumberOfResults).
-					WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).Build()
-				scenarios = append(scenarios, scenario)
-
-				scenario = explorerlib.NewScenarioBuilder().
-					WithName("2 search and click in " + lang.Value).
-					WithWeight(lang.NumberOfResults).
-					WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).Build()
-				scenarios = append(scenarios, scenario)
-
-				scenario = explorerlib.NewScenarioBuilder().
-					WithName("3 search and click in " + lang.Value).
-					WithWeight(lang.NumberOfResults).
-					WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).Build()
-				scenarios = append(scenarios, scenario)
-
-				scenario = explorerlib.NewScenarioBuilder().
-					WithName("4 search and click in " + lang.Value).
-					WithWeight(lang.NumberOfResults).
-					WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).Build()
-				scenarios = append(scenarios, scenario)
-
-				scenario = explorerlib.NewScenarioBuilder().
-					WithName("5 search and click in " + lang.Value).
-					WithWeight(lang.NumberOfResults).
-					WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).Build()
-				scenarios = append(scenarios, scenario)
-
-				//20 page view event with a search event, no click
-				viewScenarioBuilder := explorerlib.NewScenarioBuilder().
-					WithName("views in " + lang.Value).
-					WithWeight(lang.NumberOfResults).
-					WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(false))
-				for i := 0; i < 20; i++ {
-					viewScenarioBuilder.WithEvent(explorerlib.NewViewEvent(0))
+				if dropped[explorerlib.LanguageToTag(lang.Value)] {
+					continue
+				}
+				taggedLanguages = append(taggedLanguages, explorerlib.LanguageToTag(lang.Value))
+				for _, template := range templates {
+					scenarios = append(scenarios, template.Build(lang.Value, lang.NumberOfResults, originLevel1, originLevel2))
 				}
-				scenarios = append(scenarios, viewScenarioBuilder.Build())
-
-				//Five scenarios with 1 to 5 search and click event, with View Event following search and click
-				scenario = explorerlib.NewScenarioBuilder().
-					WithName("1 search and click and pageview in " + lang.Value).
-					WithWeight(lang.NumberOfResults).
-					WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewViewEvent(0)).Build()
-				scenarios = append(scenarios, scenario)
-
-				scenario = explorerlib.NewScenarioBuilder().
-					WithName("2 search and click and pageview in " + lang.Value).
-					WithWeight(lang.NumberOfResults).WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).Build()
-				scenarios = append(scenarios, scenario)
-
-				scenario = explorerlib.NewScenarioBuilder().
-					WithName("3 search and click and pageview in " + lang.Value).
-					WithWeight(lang.NumberOfResults).WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).Build()
-				scenarios = append(scenarios, scenario)
-
-				scenario = explorerlib.NewScenarioBuilder().
-					WithName("4 search and click and pageview in " + lang.Value).
-					WithWeight(lang.NumberOfResults).
-					WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).Build()
-				scenarios = append(scenarios, scenario)
-
-				scenario = explorerlib.NewScenarioBuilder().
-					WithName("5 search and click and pageview in " + lang.Value).
-					WithWeight(lang.NumberOfResults).
-					WithLanguage(taggedLanguage).
-					WithEvent(explorerlib.NewSetOriginLevels(originLevel1, originLevel2)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).
-					WithEvent(explorerlib.NewSearchEvent(true)).
-					WithEvent(explorerlib.NewViewEvent(0)).
-					WithEvent(explorerlib.NewClickEvent(0.5)).
-					WithEvent(explorerlib.NewClickEvent(0.8)).Build()
-				scenarios = append(scenarios, scenario)
 			}
 		}
 	}
@@ -258,20 +332,55 @@ func (bot *Autobot) Run(quitChannel chan bool) error {
 		WithSearchEndpoint(bot.config.SearchEndpoint).
 		WithAnalyticsEndpoint(bot.config.AnalyticsEndpoint).AllAnonymous().
 		WithLanguages(taggedLanguages).WithGoodQueryByLanguage(goodQueries).
+		// uabot barely waits, the traffic profile of the bot spaces the visits when it has one
 		WithTimeBetweenActions(1).
 		WithTimeBetweenVisits(1).
 		WithConstantWaitTime(true).
 		WithScenarios(scenarios).
 		Save(bot.config.OutputFilePath)
-	if err != nil {
-		return err
-	}
+	return err
+}
 
-	uabot := scenariolib.NewUabot(true, bot.config.OutputFilePath, bot.config.SearchToken, bot.config.AnalyticsToken, bot.random)
+// newIndex creates the index explored by the bot, recording its search
+// requests or replaying them from the search archive of the bot if it has
+// one, the function returned closes the archive.
+func (bot *Autobot) newIndex() (explorerlib.Index, func() error, error) {
+	noArchive := func() error { return nil }
+	if bot.config.SearchArchiveMode == explorerlib.REPLAYARCHIVE {
+		bot.logger.Infof("Replaying the search requests from %v", bot.config.SearchArchivePath)
+		index, err := explorerlib.NewReplayIndex(bot.config.SearchArchivePath)
+		return index, noArchive, err
+	}
+	index, err := explorerlib.NewIndex(
+		bot.config.SearchEndpoint,
+		string(bot.config.SearchToken),
+		bot.config.Org,
+		bot.rateLimiters.For(bot.config.SearchEndpoint, bot.config.Org),
+		bot.retryPolicy)
+	if err != nil || bot.config.SearchArchiveMode != explorerlib.RECORDARCHIVE {
+		return index, noArchive, err
+	}
+	bot.logger.Infof("Recording the search requests to %v", bot.config.SearchArchivePath)
+	return index.Recording(bot.config.SearchArchivePath)
+}
 
-	scenariolib.Info.Println("Running Bot")
-	err = uabot.Run(quitChannel)
-	return err
+// dropLanguagesUnderMinimum marks the languages with fewer queries than the
+// minimum as dropped and returns them, it fails when every language is
+// dropped, the report of the languages tells why.
+func dropLanguagesUnderMinimum(reports []explorerlib.LanguageQueryReport, minimum int) (map[string]bool, error) {
+	dropped := make(map[string]bool)
+	missing := []string{}
+	for i, report := range reports {
+		if report.Accepted < minimum {
+			reports[i].Dropped = true
+			dropped[report.Language] = true
+			missing = append(missing, fmt.Sprintf("%v (%v)", report.Language, report.Accepted))
+		}
+	}
+	if len(reports) > 0 && len(dropped) == len(reports) {
+		return dropped, fmt.Errorf("Fewer than %v queries found in every language, %v, see the query report of the job", minimum, strings.Join(missing, ", "))
+	}
+	return dropped, nil
 }
 
 func (bot *Autobot) GetInfo() map[string]interface{} {
@@ -281,10 +390,14 @@ func (bot *Autobot) GetInfo() map[string]interface{} {
 		"averageNumberOfWordsPerQuery":   bot.config.AverageNumberOfWordsPerQuery,
 		"documentsExplorationPercentage": bot.config.DocumentsExplorationPercentage,
 		"fieldsToExploreEqually":         bot.config.FieldsToExploreEqually,
-		"org":                      bot.config.Org,
-		"outputFilepath":           bot.config.OutputFilePath,
-		"numberOfQueryPerLanguage": bot.config.NumberOfQueryByLanguage,
-		"numberOfResultsPerQuery":  bot.config.FetchNumberOfResults,
-		"originLevels":             bot.config.OriginLevels,
+		"org":                            bot.config.Org,
+		"outputFilepath":                 bot.config.OutputFilePath,
+		"numberOfQueryPerLanguage":       bot.config.NumberOfQueryByLanguage,
+		"numberOfResultsPerQuery":        bot.config.FetchNumberOfResults,
+		"originLevels":                   bot.config.OriginLevels,
+		"eventSink":                      bot.config.EventSink,
+		"seed":                           bot.config.Seed,
+		"trafficProfile":                 bot.config.TrafficProfile,
+		"target":                         bot.config.Target,
 	}
 }
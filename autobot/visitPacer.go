@@ -0,0 +1,78 @@
+package autobot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/coveo/uabot-server/explorerlib"
+)
+
+// pacer returns the time the next visit of a bot is due
+type pacer interface {
+	Next(now time.Time) time.Time
+}
+
+type visitPacer struct {
+	ctx context.Context
+	// pacer is nil for a bot visiting as fast as it can
+	pacer pacer
+	// target is nil for a bot without a target
+	target *explorerlib.TargetPacer
+}
+
+var (
+	// visitPacers holds the pacer of the running bots with a traffic profile
+	// or a target by the analytics token they give to uabot
+	visitPacers      = make(map[string]visitPacer)
+	visitPacersMutex sync.Mutex
+)
+
+func setVisitPacer(analyticsToken string, paced *visitPacer) {
+	visitPacersMutex.Lock()
+	defer visitPacersMutex.Unlock()
+	if paced == nil {
+		delete(visitPacers, analyticsToken)
+		return
+	}
+	visitPacers[analyticsToken] = *paced
+}
+
+func getVisitPacer(analyticsToken string) (visitPacer, bool) {
+	visitPacersMutex.Lock()
+	defer visitPacersMutex.Unlock()
+	paced, ok := visitPacers[analyticsToken]
+	return paced, ok
+}
+
+// WaitForVisit waits until the bot running with the analytics token is due
+// for its next visit or is stopped, it returns right away for a bot without
+// a traffic profile or a target. It is set as the scenariolib.WaitForVisit hook.
+func WaitForVisit(analyticsToken string) {
+	paced, ok := getVisitPacer(analyticsToken)
+	if !ok {
+		return
+	}
+	if paced.pacer != nil {
+		now := time.Now()
+		timer := time.NewTimer(paced.pacer.Next(now).Sub(now))
+		select {
+		case <-timer.C:
+		case <-paced.ctx.Done():
+		}
+		timer.Stop()
+	}
+	if paced.target != nil {
+		paced.target.VisitStarted()
+	}
+}
+
+// EventSent counts the events sent by the bot running with the analytics
+// token toward its target, it is called by the scenariolib.EventSent hook.
+func EventSent(analyticsToken string, eventType string, err error) {
+	paced, ok := getVisitPacer(analyticsToken)
+	if !ok || paced.target == nil || err != nil {
+		return
+	}
+	paced.target.EventSent(eventType)
+}
@@ -0,0 +1,31 @@
+package autobot
+
+import (
+	"math/rand"
+	"sync"
+)
+
+var (
+	// visitRandoms holds the random of the running bots by the analytics token they give to uabot
+	visitRandoms      = make(map[string]*rand.Rand)
+	visitRandomsMutex sync.Mutex
+)
+
+func setVisitRandom(analyticsToken string, random *rand.Rand) {
+	visitRandomsMutex.Lock()
+	defer visitRandomsMutex.Unlock()
+	if random == nil {
+		delete(visitRandoms, analyticsToken)
+		return
+	}
+	visitRandoms[analyticsToken] = random
+}
+
+// VisitRandom returns the random of the bot running with the analytics token,
+// nil if there is none. It is set as the scenariolib.VisitRandom hook so the
+// visits of a seeded bot are the same on every run.
+func VisitRandom(analyticsToken string) *rand.Rand {
+	visitRandomsMutex.Lock()
+	defer visitRandomsMutex.Unlock()
+	return visitRandoms[analyticsToken]
+}
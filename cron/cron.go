@@ -0,0 +1,195 @@
+// Package cron parses the standard five fields cron expressions, minute hour
+// day-of-month month day-of-week, and finds the next time they match.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MAXIMUMSEARCHYEARS bounds the search of the next match of an expression that never matches, like 0 0 30 2 *
+const MAXIMUMSEARCHYEARS int = 5
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField      = field{"minute", 0, 59, nil}
+	hourField        = field{"hour", 0, 23, nil}
+	dayField         = field{"day of month", 1, 31, nil}
+	monthField       = field{"month", 1, 12, monthNames}
+	weekdayField     = field{"day of week", 0, 7, weekdayNames}
+	expressionFields = []field{minuteField, hourField, dayField, monthField, weekdayField}
+)
+
+// Expression is a parsed cron expression, every field is a set of values
+type Expression struct {
+	text     string
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// a day matches either field when both are restricted, as in Vixie cron
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+// Parse reads an expression like "*/15 9-17 * * MON-FRI" or a macro like "@daily"
+func Parse(text string) (*Expression, error) {
+	expanded := strings.TrimSpace(text)
+	if macro, ok := macros[strings.ToLower(expanded)]; ok {
+		expanded = macro
+	}
+	parts := strings.Fields(expanded)
+	if len(parts) != len(expressionFields) {
+		return nil, fmt.Errorf("Invalid cron expression %q, should have 5 fields: minute hour day-of-month month day-of-week", text)
+	}
+	sets := make([]uint64, len(parts))
+	for i, part := range parts {
+		set, err := expressionFields[i].parse(part)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %q: %v", text, err)
+		}
+		sets[i] = set
+	}
+	// 7 is also sunday
+	weekdays := sets[4]
+	if weekdays&(1<<7) != 0 {
+		weekdays = weekdays&^(1<<7) | 1
+	}
+	return &Expression{
+		text:               text,
+		minutes:            sets[0],
+		hours:              sets[1],
+		days:               sets[2],
+		months:             sets[3],
+		weekdays:           weekdays,
+		daysRestricted:     !strings.HasPrefix(parts[2], "*"),
+		weekdaysRestricted: !strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+func (expression *Expression) String() string {
+	return expression.text
+}
+
+// parse reads the comma separated list of values, ranges and steps of a field
+func (field field) parse(text string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(text, ",") {
+		step := 1
+		if parts := strings.SplitN(item, "/", 2); len(parts) == 2 {
+			var err error
+			step, err = strconv.Atoi(parts[1])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in the %v", parts[1], field.name)
+			}
+			item = parts[0]
+		}
+		first, last := field.min, field.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			first, err = field.value(bounds[0])
+			if err != nil {
+				return 0, err
+			}
+			last = first
+			if len(bounds) == 2 {
+				last, err = field.value(bounds[1])
+				if err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// 5/15 means from 5 to the end of the field every 15
+				last = field.max
+			}
+			if last < first {
+				return 0, fmt.Errorf("invalid range %q in the %v", item, field.name)
+			}
+		}
+		for value := first; value <= last; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+func (field field) value(text string) (int, error) {
+	if value, ok := field.names[strings.ToLower(text)]; ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil || value < field.min || value > field.max {
+		return 0, fmt.Errorf("invalid value %q in the %v, should be in [%v,%v]", text, field.name, field.min, field.max)
+	}
+	return value, nil
+}
+
+func has(set uint64, value int) bool {
+	return set&(1<<uint(value)) != 0
+}
+
+func (expression *Expression) matchesDay(t time.Time) bool {
+	day := has(expression.days, t.Day())
+	weekday := has(expression.weekdays, int(t.Weekday()))
+	if expression.daysRestricted && expression.weekdaysRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Next returns the first minute strictly after the given time matching the
+// expression, in the location of the given time, or the zero time if it
+// does not match in the next MAXIMUMSEARCHYEARS years.
+func (expression *Expression) Next(after time.Time) time.Time {
+	location := after.Location()
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, location).Add(time.Minute)
+	limit := t.AddDate(MAXIMUMSEARCHYEARS, 0, 0)
+	for t.Before(limit) {
+		if !has(expression.months, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !expression.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !has(expression.hours, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, location)
+			continue
+		}
+		if !has(expression.minutes, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
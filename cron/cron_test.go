@@ -0,0 +1,66 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * foo *",
+	} {
+		if _, err := Parse(text); err == nil {
+			t.Errorf("Parse(%q) should fail", text)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// a wednesday
+	after := time.Date(2024, time.January, 10, 10, 7, 30, 0, time.UTC)
+	for _, test := range []struct {
+		text string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.January, 10, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.January, 10, 10, 15, 0, 0, time.UTC)},
+		{"5/15 * * * *", time.Date(2024, time.January, 10, 10, 20, 0, 0, time.UTC)},
+		{"0 9-17 * * MON-FRI", time.Date(2024, time.January, 10, 11, 0, 0, 0, time.UTC)},
+		{"30 8 * * sat,sun", time.Date(2024, time.January, 13, 8, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.January, 11, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// the day of month or the day of week matches when both are restricted
+		{"0 0 20 * mon", time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)},
+	} {
+		expression, err := Parse(test.text)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", test.text, err)
+			continue
+		}
+		if got := expression.Next(after); !got.Equal(test.want) {
+			t.Errorf("Next of %q = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestNextNeverMatching(t *testing.T) {
+	expression, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := expression.Next(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next of an expression that never matches = %v, want the zero time", got)
+	}
+}
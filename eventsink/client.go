@@ -0,0 +1,137 @@
+package eventsink
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	ua "github.com/coveo/go-coveo/analytics"
+)
+
+// TOKENPREFIX starts the analytics token handed to uabot by a job, the visits
+// of the job find where to send their events with it.
+const TOKENPREFIX string = "sink:"
+
+var ErrUnknownToken = errors.New("No job is registered for this analytics token, it has probably stopped")
+
+type registration struct {
+	job  string
+	org  string
+	sink Sink
+	// analyticsToken is the token of the job, used when it has no sink
+	analyticsToken string
+}
+
+var (
+	registrations = make(map[string]registration)
+	mutex         sync.Mutex
+)
+
+// Register makes the sink receive the events of a job, or the analytics
+// endpoint with the analytics token of the job if the sink is nil, and
+// returns the token the job gives to uabot in place of its own.
+func Register(job string, org string, sink Sink, analyticsToken string) string {
+	token := TOKENPREFIX + job
+	mutex.Lock()
+	defer mutex.Unlock()
+	registrations[token] = registration{job: job, org: org, sink: sink, analyticsToken: analyticsToken}
+	return token
+}
+
+// Unregister closes the sink registered with the token
+func Unregister(token string) error {
+	mutex.Lock()
+	registered, ok := registrations[token]
+	delete(registrations, token)
+	mutex.Unlock()
+	if !ok || registered.sink == nil {
+		return nil
+	}
+	return registered.sink.Close()
+}
+
+// Wrap returns a function creating the analytics client of a visit, writing
+// to the sink registered with the token of the visit if there is one and
+// created by next with the real token otherwise. It replaces
+// scenariolib.NewAnalyticsClient.
+func Wrap(next func(config ua.Config) (ua.Client, error)) func(config ua.Config) (ua.Client, error) {
+	return func(config ua.Config) (ua.Client, error) {
+		if !strings.HasPrefix(config.Token, TOKENPREFIX) {
+			return next(config)
+		}
+		mutex.Lock()
+		registered, ok := registrations[config.Token]
+		mutex.Unlock()
+		if !ok {
+			return nil, ErrUnknownToken
+		}
+		if registered.sink == nil {
+			config.Token = registered.analyticsToken
+			return next(config)
+		}
+		return &client{registration: registered, ip: config.IP, userAgent: config.UserAgent}, nil
+	}
+}
+
+// client is the analytics client of a visit writing to a sink
+type client struct {
+	registration
+	ip        string
+	userAgent string
+}
+
+func (client *client) write(eventType string, event interface{}) error {
+	return client.sink.Write(Record{
+		Time:      time.Now(),
+		Job:       client.job,
+		Org:       client.org,
+		Type:      eventType,
+		IP:        client.ip,
+		UserAgent: client.userAgent,
+		Event:     event,
+	})
+}
+
+func (client *client) SendSearchEvent(event *ua.SearchEvent) error {
+	return client.write("search", event)
+}
+
+func (client *client) SendSearchesEvent(events []ua.SearchEvent) error {
+	for i := range events {
+		err := client.write("search", &events[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (client *client) SendClickEvent(event *ua.ClickEvent) error {
+	return client.write("click", event)
+}
+
+func (client *client) SendCustomEvent(event ua.CustomEvent) error {
+	return client.write("custom", event)
+}
+
+func (client *client) SendViewEvent(event *ua.ViewEvent) error {
+	return client.write("view", event)
+}
+
+func (client *client) GetVisit() (*ua.VisitResponse, error) {
+	return nil, nil
+}
+
+func (client *client) GetStatus() (*ua.StatusResponse, error) {
+	return nil, nil
+}
+
+func (client *client) DeleteVisit() (bool, error) {
+	return true, nil
+}
+
+func (client *client) GetCookies() []*http.Cookie {
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package eventsink writes the analytics events of the bots somewhere else
+// than the usage analytics API, one JSON object per line in a file or on
+// stdout, to build datasets or check what a bot does without touching an org.
+package eventsink
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Kinds of sink a job can send its events to
+const (
+	// COVEO sends the events to the analytics endpoint, the default
+	COVEO  string = "coveo"
+	FILE   string = "file"
+	STDOUT string = "stdout"
+)
+
+// Record is a line written to a sink, an analytics event as it would have
+// been sent along with the visit it belongs to.
+type Record struct {
+	Time      time.Time   `json:"time"`
+	Job       string      `json:"job"`
+	Org       string      `json:"org"`
+	Type      string      `json:"type"`
+	IP        string      `json:"ip,omitempty"`
+	UserAgent string      `json:"userAgent,omitempty"`
+	Event     interface{} `json:"event"`
+}
+
+// Sink receives the analytics events of a job
+type Sink interface {
+	Write(record Record) error
+	Close() error
+}
+
+// IsValid tells if kind is a sink a job can use, empty for COVEO
+func IsValid(kind string) bool {
+	return kind == "" || kind == COVEO || kind == FILE || kind == STDOUT
+}
+
+// Open creates a sink of the given kind, path is only used by FILE. The
+// events of a COVEO job are sent by uabot, it has no sink.
+func Open(kind string, path string) (Sink, error) {
+	switch kind {
+	case FILE:
+		return NewFileSink(path)
+	case STDOUT:
+		return stdout, nil
+	}
+	return nil, fmt.Errorf("Unknown event sink %q, should be coveo, file or stdout", kind)
+}
+
+// writerSink encodes the records as newline delimited JSON
+type writerSink struct {
+	writer io.Writer
+	closer io.Closer
+	mutex  sync.Mutex
+}
+
+// stdout is shared by the jobs writing to the standard output, it is never closed
+var stdout = NewWriterSink(os.Stdout, nil)
+
+// NewWriterSink writes the records to writer, closer is closed with the sink unless it is nil
+func NewWriterSink(writer io.Writer, closer io.Closer) Sink {
+	return &writerSink{writer: writer, closer: closer}
+}
+
+// NewFileSink appends the records to the file, created with its directory if needed
+func NewFileSink(path string) (Sink, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterSink(file, file), nil
+}
+
+func (sink *writerSink) Write(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	// a single write per record so the lines of concurrent jobs never mix
+	_, err = sink.writer.Write(append(line, '\n'))
+	return err
+}
+
+func (sink *writerSink) Close() error {
+	if sink.closer == nil {
+		return nil
+	}
+	return sink.closer.Close()
+}
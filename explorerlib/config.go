@@ -6,19 +6,41 @@ import (
 )
 
 type Config struct {
-	FetchNumberOfResults           int                     `json:"fetchQueryNumber"`
-	DocumentsExplorationPercentage float64                 `json:"explorationRatio"`
-	FieldsToExploreEqually         []string                `json:"fields"`
-	SearchEndpoint                 string                  `json:"searchEndpoint"`
-	SearchToken                    string                  `json:"searchToken"`
-	NumberOfQueryByLanguage        int                     `json:"numberOfQueryPerLanguage"`
-	AnalyticsEndpoint              string                  `json:"analyticsEndpoint"`
-	AnalyticsToken                 string                  `json:"analyticsToken"`
-	Org                            string                  `json:"org"`
-	OutputFilePath                 string                  `json:"outputFilePath"`
-	AverageNumberOfWordsPerQuery   int                     `json:"avgNumberWordsPerQuery"`
-	MainScenario                   []*scenariolib.Scenario `json:"scenario"`
-	TimeToLive                     int                     `json:"timeToLive"`
-	OriginLevels                   map[string][]string     `json:"originLevels"`
-	Id                             uuid.UUID               `json:"id"`
+	FetchNumberOfResults           int                 `json:"fetchQueryNumber"`
+	DocumentsExplorationPercentage float64             `json:"explorationRatio"`
+	FieldsToExploreEqually         []string            `json:"fields"`
+	SearchEndpoint                 string              `json:"searchEndpoint"`
+	SearchToken                    Secret              `json:"searchToken"`
+	NumberOfQueryByLanguage        int                 `json:"numberOfQueryPerLanguage"`
+	QueryAttemptsPerLanguage       int                 `json:"queryAttemptsPerLanguage"`
+	MinimumQueriesPerLanguage      int                 `json:"minimumQueriesPerLanguage"`
+	AnalyticsEndpoint              string              `json:"analyticsEndpoint"`
+	AnalyticsToken                 Secret              `json:"analyticsToken"`
+	Org                            string              `json:"org"`
+	OutputFilePath                 string              `json:"outputFilePath"`
+	AverageNumberOfWordsPerQuery   int                 `json:"avgNumberWordsPerQuery"`
+	Scenarios                      []ScenarioTemplate  `json:"scenarios"`
+	TimeToLive                     int                 `json:"timeToLive"`
+	OriginLevels                   map[string][]string `json:"originLevels"`
+	Id                             uuid.UUID           `json:"id"`
+	RefreshVocabulary              bool                `json:"refreshVocabulary"`
+	PlanOnly                       bool                `json:"planOnly"`
+	// EventSink is where the analytics events go, coveo, file or stdout
+	EventSink string `json:"eventSink,omitempty"`
+	// EventsFilePath is the file the events are appended to by the file sink
+	EventsFilePath string `json:"eventsFilePath,omitempty"`
+	// SearchArchiveMode records the search requests of the exploration to
+	// SearchArchivePath or replays them from it, see RECORDARCHIVE and REPLAYARCHIVE
+	SearchArchiveMode string `json:"searchArchiveMode,omitempty"`
+	SearchArchivePath string `json:"searchArchivePath,omitempty"`
+	// Seed of the random picking the queries and the visits, the same seed gives the same run
+	Seed *int64 `json:"seed,omitempty"`
+	// TrafficProfile spaces the visits like the traffic of a real site, they follow each other without it
+	TrafficProfile *TrafficProfile `json:"trafficProfile,omitempty"`
+	// Target is the rate or the budget of visits or events of the bot, it only stops at the end of its time to live without it
+	Target *Target `json:"target,omitempty"`
+	// Priority orders the jobs waiting for a routine, the highest first
+	Priority int `json:"priority,omitempty"`
+	// UabotConfig is run as is, without exploring the index, when it is provided
+	UabotConfig *scenariolib.Config `json:"uabotConfig,omitempty"`
 }
@@ -78,7 +78,11 @@ func (builder *botConfigurationBuilder) Build() *scenariolib.Config {
 }
 
 func (builder *botConfigurationBuilder) Save(path string) error {
-	bytes, err := json.Marshal(builder.config)
+	return SaveUabotConfig(&builder.config, path)
+}
+
+func SaveUabotConfig(config *scenariolib.Config, path string) error {
+	bytes, err := json.Marshal(config)
 	if err != nil {
 		return err
 	}
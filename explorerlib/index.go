@@ -1,109 +1,140 @@
 package explorerlib
 
 import (
-	"fmt"
+	"context"
 	"github.com/coveo/go-coveo/search"
-	"github.com/coveo/uabot/scenariolib"
+	"github.com/coveo/uabot-server/logging"
 	"github.com/jmcvetta/randutil"
-	"github.com/satori/go.uuid"
 	"math"
-	"time"
+	"math/rand"
+	"sort"
 )
 
 type Index struct {
-	Client search.Client
+	Client SearchClient
 }
 
-var (
-	t1                time.Time
-	t2                time.Time
-	t3                time.Time
-	dt1               time.Duration
-	dt2               time.Duration
-	dt3               time.Duration
-	numberOfActiveBot int = 0
-	throttle          time.Duration
-)
-
-func NewIndex(endpoint string, searchToken string) (Index, error) {
-	client, err := search.NewClient(search.Config{
-		Endpoint:  endpoint,
-		Token:     searchToken,
-		UserAgent: "",
-	})
-	return Index{Client: client}, err
+// NewIndex creates a client for the index of an org, the org labels the search
+// metrics, the requests wait for the limiter unless it is nil and are retried
+// following the policy. Every retry waits for the limiter and is measured.
+func NewIndex(endpoint string, searchToken string, org string, limiter *RateLimiter, policy RetryPolicy) (Index, error) {
+	var client SearchClient = NewSearchClient(endpoint, searchToken, policy)
+	client = limitedClient{SearchClient: meteredClient{SearchClient: client, org: org}, limiter: limiter}
+	return Index{Client: retryingClient{SearchClient: client, policy: policy}}, nil
 }
 
-func (index *Index) FetchLanguages() ([]string, error) {
-	languageFacetValues, err := index.Client.ListFacetValues("@syslanguage", math.MaxInt16)
+func (index *Index) FetchLanguages(ctx context.Context) ([]string, error) {
+	languageFacetValues, err := index.Client.ListFacetValues(ctx, "@syslanguage", math.MaxInt16)
+	if err != nil {
+		return nil, err
+	}
 	languages := []string{}
 	for _, value := range languageFacetValues.Values {
 		languages = append(languages, value.Value)
 	}
-	return languages, err
+	return languages, nil
 }
 
-func (index *Index) FetchFieldValues(field string) (*search.FacetValues, error) {
-	return index.Client.ListFacetValues(field, 1000)
+func (index *Index) FetchFieldValues(ctx context.Context, field string) (*search.FacetValues, error) {
+	return index.Client.ListFacetValues(ctx, field, 1000)
 }
 
-func (index *Index) FindTotalCountFromQuery(query search.Query) (int, error) {
-	response, status := index.Client.Query(query)
-	return response.TotalCount, status
+func (index *Index) FindTotalCountFromQuery(ctx context.Context, query search.Query) (int, error) {
+	response, err := index.Client.Query(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return response.TotalCount, nil
 }
 
-func (index *Index) FetchResponse(queryExpression string, numberOfResults int) (*search.Response, error) {
-	return index.Client.Query(search.Query{
+func (index *Index) FetchResponse(ctx context.Context, queryExpression string, numberOfResults int) (*search.Response, error) {
+	return index.Client.Query(ctx, search.Query{
 		AQ:              queryExpression,
 		NumberOfResults: numberOfResults,
 	})
 }
 
-func (index *Index) BuildGoodQueries(wordCountsByLanguage map[string]WordCounts, numberOfQueryByLanguage int, averageNumberOfWords int, minTime time.Duration, botId uuid.UUID) (map[string][]string, error) {
+// LanguageQueryReport tells how the queries of a language were found
+type LanguageQueryReport struct {
+	Language string `json:"language"`
+	// Attempts counts the queries picked, including the duplicates that were not sent
+	Attempts    int `json:"attempts"`
+	ZeroResults int `json:"zeroResults"`
+	// Duplicates counts the queries picked again after being accepted or returning no results
+	Duplicates int `json:"duplicates"`
+	Accepted   int `json:"accepted"`
+	// BudgetExhausted is true when the attempts ran out before finding enough queries
+	BudgetExhausted bool `json:"budgetExhausted"`
+	// Dropped is true when the language has fewer queries than the minimum, the bot does not visit it
+	Dropped bool `json:"dropped,omitempty"`
+}
 
-	numberOfActiveBot++
-	throttle = (minTime * time.Millisecond) * time.Duration(numberOfActiveBot)
-	scenariolib.Info.Printf("Throttled at : %v", throttle)
+// BuildGoodQueries picks queries from the words of every language and keeps
+// those returning results, at most attemptsPerLanguage queries are picked in
+// a language so a small vocabulary cannot keep it looking forever. The
+// languages are visited in order so a seeded random picks the same queries.
+func (index *Index) BuildGoodQueries(ctx context.Context, random *rand.Rand, wordCountsByLanguage map[string]WordCounts, numberOfQueryByLanguage int, attemptsPerLanguage int, averageNumberOfWords int, progress ProgressReporter, logger *logging.Logger) (map[string][]string, []LanguageQueryReport, error) {
 
 	queriesInLanguage := make(map[string][]string)
-	scenariolib.Info.Println("Building queries and calling the index to validate that they return results")
+	reports := []LanguageQueryReport{}
+	logger.Infof("Building queries and calling the index to validate that they return results")
 
-	for language, wordCounts := range wordCountsByLanguage {
+	progress.StartPhase(QUERYBUILDINGPHASE, len(wordCountsByLanguage)*numberOfQueryByLanguage)
+	languages := make([]string, 0, len(wordCountsByLanguage))
+	for language := range wordCountsByLanguage {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	for _, language := range languages {
+		wordCounts := wordCountsByLanguage[language]
+		progress.VisitLanguage(language)
 		words := []string{}
+		// the queries without results are not sent again
+		rejected := make(map[string]bool)
+		report := LanguageQueryReport{Language: language}
 
 		choices := make([]randutil.Choice, 0, wordCounts.TotalCount)
 		for _, wordCount := range wordCounts.Words {
 			choices = append(choices, randutil.Choice{wordCount.Count, wordCount.Word})
 		}
 
-		t2 = time.Now()
-		for i := 0; i < numberOfQueryByLanguage; {
-			word := wordCounts.PickExpNWordsWeighted(choices, averageNumberOfWords)
-
-			dt2 = time.Since(t2)
-			if dt2 < throttle {
-				time.Sleep(throttle - dt2)
+		for len(choices) > 0 && report.Accepted < numberOfQueryByLanguage {
+			if report.Attempts >= attemptsPerLanguage {
+				report.BudgetExhausted = true
+				break
 			}
-			t2 = time.Now()
-			response, err := index.FetchResponse(word, 10)
+			report.Attempts++
+			word := wordCounts.PickExpNWordsWeighted(random, choices, averageNumberOfWords)
+			if rejected[word] || contains(words, word) {
+				report.Duplicates++
+				continue
+			}
+			progress.IssueQuery()
+			response, err := index.FetchResponse(ctx, word, 10)
 
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
-			//todo fix this display fonction when multiple bot are working
-			if len(response.Results) > 0 && !contains(words, word) {
-				words = append(words, word)
-				i++
-				fmt.Printf("\rBot %v : Building and validating queries: %.0f %% completed for language %s", botId, (float32(i)/float32(numberOfQueryByLanguage))*100, language)
+			if len(response.Results) == 0 {
+				rejected[word] = true
+				report.ZeroResults++
+				continue
 			}
+			words = append(words, word)
+			report.Accepted++
+			progress.FindGoodQuery(language)
+			progress.CompleteStep()
+		}
+		// the queries that were not found still count as done for the progress
+		for i := report.Accepted; i < numberOfQueryByLanguage; i++ {
+			progress.CompleteStep()
 		}
-		fmt.Printf("\n")
-		scenariolib.Info.Printf("Total number of good queries in %v: %v", language, len(words))
+		logger.Infof("Total number of good queries in %v: %v after %v attempts, %v without results and %v duplicates",
+			language, len(words), report.Attempts, report.ZeroResults, report.Duplicates)
 		queriesInLanguage[language] = words
+		reports = append(reports, report)
 
 	}
-	fmt.Printf("\n")
-	numberOfActiveBot--
-	return queriesInLanguage, nil
+	return queriesInLanguage, reports, nil
 }
@@ -1,46 +1,53 @@
 package explorerlib
 
 import (
+	"context"
 	"github.com/coveo/go-coveo/search"
-	"github.com/coveo/uabot/scenariolib"
-	"time"
+	"github.com/coveo/uabot-server/logging"
+	"math/rand"
 )
 
-func FindWordsByLanguageInIndex(index Index, fields []string, documentsExplorationPercentage float64, fetchNumberOfResults int, minTime time.Duration) (map[string]WordCounts, error) {
-
-	numberOfActiveBot++
-	throttle = (minTime * time.Millisecond) * time.Duration(numberOfActiveBot)
-	scenariolib.Info.Printf("Throttled at : %v", throttle)
-
-	scenariolib.Info.Printf("Number of active bot : %v", numberOfActiveBot)
+func FindWordsByLanguageInIndex(ctx context.Context, index Index, random *rand.Rand, fields []string, documentsExplorationPercentage float64, fetchNumberOfResults int, progress ProgressReporter, logger *logging.Logger) (map[string]WordCounts, error) {
 	wordCountsByLanguage := make(map[string]WordCounts)
 	wordsByFieldValueByLanguage := map[string][]WordsByFieldValue{}
-	languages, status := index.FetchLanguages()
+	languages, status := index.FetchLanguages(ctx)
 	if status != nil {
 		return nil, status
 	}
+	// the values fetched up front give the size of the exploration and are
+	// used for the first language, the next languages fetch them again
+	valuesByField := make(map[string]*search.FacetValues)
+	numberOfFieldValues := 0
+	for _, field := range fields {
+		values, status := index.FetchFieldValues(ctx, field)
+		if status != nil {
+			return nil, status
+		}
+		valuesByField[field] = values
+		numberOfFieldValues += len(values.Values)
+	}
+	progress.StartPhase(EXPLORATIONPHASE, len(languages)*numberOfFieldValues)
 	// for each language
-	for _, language := range languages {
+	for i, language := range languages {
+		progress.VisitLanguage(language)
 		// discover Words
 		// for every fields provided
 		for _, field := range fields {
-			values, status := index.FetchFieldValues(field)
-			if status != nil {
-				return nil, status
+			values := valuesByField[field]
+			if i > 0 {
+				values, status = index.FetchFieldValues(ctx, field)
+				if status != nil {
+					return nil, status
+				}
 			}
-			t1 = time.Now()
 			// for all values of the field
 			for _, value := range values.Values {
+				progress.VisitFieldValue(field, value.Value)
 
 				wordCounts := WordCounts{}
 
-				dt1 = time.Since(t1)
-				if dt1 < throttle {
-					time.Sleep(throttle - dt1)
-				}
-				t1 = time.Now()
-
-				totalCount, status := index.FindTotalCountFromQuery(search.Query{
+				progress.IssueQuery()
+				totalCount, status := index.FindTotalCountFromQuery(ctx, search.Query{
 					AQ: "@syslanguage=\"" + language + "\" " + field + "=\"" + value.Value + "\"",
 				})
 				if status != nil {
@@ -55,7 +62,6 @@ func FindWordsByLanguageInIndex(index Index, fields []string, documentsExplorati
 				}
 				randomWord := ""
 
-				t3 = time.Now()
 				for i := 0; i < queryNumber; i++ {
 
 					// build A query from the word counts in the appropriate language with a filter on the field value
@@ -63,12 +69,8 @@ func FindWordsByLanguageInIndex(index Index, fields []string, documentsExplorati
 						" @syslanguage=\"" + language + "\" " +
 						field + "=\"" + value.Value + "\" "
 
-					dt3 = time.Since(t3)
-					if dt3 < throttle {
-						time.Sleep(throttle - dt3)
-					}
-					t3 = time.Now()
-					response, status := index.FetchResponse(queryExpression, fetchNumberOfResults)
+					progress.IssueQuery()
+					response, status := index.FetchResponse(ctx, queryExpression, fetchNumberOfResults)
 					if status != nil {
 						return nil, status
 					}
@@ -78,7 +80,7 @@ func FindWordsByLanguageInIndex(index Index, fields []string, documentsExplorati
 					// update word counts
 					wordCounts = wordCounts.Extend(newWordCounts)
 					// pick a random word (Probability by popularity, or constant)
-					randomWord = wordCounts.PickRandomWord()
+					randomWord = wordCounts.PickRandomWord(random)
 				}
 				taggedLanguage := LanguageToTag(language)
 				wordsByFieldValueByLanguage[taggedLanguage] = append(wordsByFieldValueByLanguage[taggedLanguage], WordsByFieldValue{
@@ -86,6 +88,7 @@ func FindWordsByLanguageInIndex(index Index, fields []string, documentsExplorati
 					FieldValue: value.Value,
 					Words:      wordCounts,
 				})
+				progress.CompleteStep()
 			}
 		}
 	}
@@ -97,8 +100,7 @@ func FindWordsByLanguageInIndex(index Index, fields []string, documentsExplorati
 		}
 		RankByWordCount(wordCounts)
 		wordCountsByLanguage[language] = wordCounts
-		scenariolib.Info.Print("language : ", language, " : Total words count ", len(wordCounts.Words))
+		logger.Infof("language : %v : Total words count %v", language, len(wordCounts.Words))
 	}
-	numberOfActiveBot--
 	return wordCountsByLanguage, nil
 }
@@ -0,0 +1,39 @@
+package explorerlib
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/coveo/go-coveo/search"
+	"github.com/coveo/uabot-server/logging"
+)
+
+// emptyClient answers every query without results and counts them
+type emptyClient struct {
+	SearchClient
+	queries map[string]int
+}
+
+func (client emptyClient) Query(ctx context.Context, query search.Query) (*search.Response, error) {
+	client.queries[query.AQ]++
+	return &search.Response{}, nil
+}
+
+func TestBuildGoodQueriesDoesNotSendAQueryWithoutResultsAgain(t *testing.T) {
+	client := emptyClient{queries: make(map[string]int)}
+	index := Index{Client: client}
+	wordCounts := map[string]WordCounts{"en": {Words: []WordCount{{"dead", 3}}, TotalCount: 3}}
+
+	queries, reports, err := index.BuildGoodQueries(context.Background(), rand.New(rand.NewSource(1)), wordCounts, 5, 20, 1, NopProgressReporter(), logging.ForJob("job", "org"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.queries["dead"] != 1 {
+		t.Errorf("sent the query without results %v times, want 1", client.queries["dead"])
+	}
+	report := reports[0]
+	if len(queries["en"]) != 0 || report.Attempts != 20 || report.ZeroResults != 1 || report.Duplicates != 19 || !report.BudgetExhausted {
+		t.Errorf("report %+v", report)
+	}
+}
@@ -0,0 +1,29 @@
+package explorerlib
+
+import (
+	"context"
+	"time"
+
+	"github.com/coveo/go-coveo/search"
+	"github.com/coveo/uabot-server/metrics"
+)
+
+// meteredClient counts the search requests of an org and how long they take
+type meteredClient struct {
+	SearchClient
+	org string
+}
+
+func (client meteredClient) Query(ctx context.Context, query search.Query) (*search.Response, error) {
+	start := time.Now()
+	response, err := client.SearchClient.Query(ctx, query)
+	metrics.ObserveSearchRequest(client.org, metrics.QUERYREQUEST, start, err)
+	return response, err
+}
+
+func (client meteredClient) ListFacetValues(ctx context.Context, field string, maximumNumberOfValues int) (*search.FacetValues, error) {
+	start := time.Now()
+	values, err := client.SearchClient.ListFacetValues(ctx, field, maximumNumberOfValues)
+	metrics.ObserveSearchRequest(client.org, metrics.FACETREQUEST, start, err)
+	return values, err
+}
@@ -0,0 +1,125 @@
+package explorerlib
+
+import (
+	"sync"
+)
+
+const (
+	EXPLORATIONPHASE   string = "exploration"
+	QUERYBUILDINGPHASE string = "query-building"
+)
+
+// ProgressReporter is told how far the exploration of the index and the
+// building of the queries went.
+type ProgressReporter interface {
+	// StartPhase is called when a phase begins, total is the number of steps
+	// needed to complete it
+	StartPhase(phase string, total int)
+	VisitLanguage(language string)
+	VisitFieldValue(field string, value string)
+	IssueQuery()
+	FindGoodQuery(language string)
+	// CompleteStep advances the current phase by one of its steps
+	CompleteStep()
+}
+
+type nopProgressReporter struct{}
+
+func (reporter nopProgressReporter) StartPhase(phase string, total int)         {}
+func (reporter nopProgressReporter) VisitLanguage(language string)              {}
+func (reporter nopProgressReporter) VisitFieldValue(field string, value string) {}
+func (reporter nopProgressReporter) IssueQuery()                                {}
+func (reporter nopProgressReporter) FindGoodQuery(language string)              {}
+func (reporter nopProgressReporter) CompleteStep()                              {}
+
+// NopProgressReporter ignores everything it is told
+func NopProgressReporter() ProgressReporter {
+	return nopProgressReporter{}
+}
+
+type PhaseProgress struct {
+	Phase              string  `json:"phase"`
+	LanguagesVisited   int     `json:"languagesVisited"`
+	FieldValuesVisited int     `json:"fieldValuesVisited"`
+	QueriesIssued      int     `json:"queriesIssued"`
+	GoodQueriesFound   int     `json:"goodQueriesFound"`
+	CompletedSteps     int     `json:"completedSteps"`
+	TotalSteps         int     `json:"totalSteps"`
+	PercentCompleted   float64 `json:"percentCompleted"`
+}
+
+// ProgressRecorder is a ProgressReporter keeping the progress of every phase,
+// it is safe to read it while a bot is reporting to it.
+type ProgressRecorder struct {
+	mutex    sync.Mutex
+	phases   []*PhaseProgress
+	listener func(progress PhaseProgress)
+}
+
+func NewProgressRecorder() *ProgressRecorder {
+	return &ProgressRecorder{
+		phases:   []*PhaseProgress{},
+		listener: func(progress PhaseProgress) {},
+	}
+}
+
+// OnProgress registers a function called with the current phase every time it progresses
+func (recorder *ProgressRecorder) OnProgress(listener func(progress PhaseProgress)) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.listener = listener
+}
+
+// Progress returns a copy of the progress of every phase started so far
+func (recorder *ProgressRecorder) Progress() []PhaseProgress {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	progress := make([]PhaseProgress, 0, len(recorder.phases))
+	for _, phase := range recorder.phases {
+		progress = append(progress, *phase)
+	}
+	return progress
+}
+
+func (recorder *ProgressRecorder) update(update func(phase *PhaseProgress)) {
+	recorder.mutex.Lock()
+	if len(recorder.phases) == 0 {
+		recorder.mutex.Unlock()
+		return
+	}
+	phase := recorder.phases[len(recorder.phases)-1]
+	update(phase)
+	if phase.TotalSteps > 0 {
+		phase.PercentCompleted = float64(phase.CompletedSteps) / float64(phase.TotalSteps) * 100
+	}
+	progress, listener := *phase, recorder.listener
+	recorder.mutex.Unlock()
+	listener(progress)
+}
+
+func (recorder *ProgressRecorder) StartPhase(phase string, total int) {
+	recorder.mutex.Lock()
+	recorder.phases = append(recorder.phases, &PhaseProgress{Phase: phase, TotalSteps: total})
+	recorder.mutex.Unlock()
+	recorder.update(func(phase *PhaseProgress) {})
+}
+
+func (recorder *ProgressRecorder) VisitLanguage(language string) {
+	recorder.update(func(phase *PhaseProgress) { phase.LanguagesVisited++ })
+}
+
+func (recorder *ProgressRecorder) VisitFieldValue(field string, value string) {
+	recorder.update(func(phase *PhaseProgress) { phase.FieldValuesVisited++ })
+}
+
+func (recorder *ProgressRecorder) IssueQuery() {
+	recorder.update(func(phase *PhaseProgress) { phase.QueriesIssued++ })
+}
+
+func (recorder *ProgressRecorder) FindGoodQuery(language string) {
+	recorder.update(func(phase *PhaseProgress) { phase.GoodQueriesFound++ })
+}
+
+func (recorder *ProgressRecorder) CompleteStep() {
+	recorder.update(func(phase *PhaseProgress) { phase.CompletedSteps++ })
+}
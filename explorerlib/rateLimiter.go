@@ -0,0 +1,152 @@
+package explorerlib
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coveo/go-coveo/search"
+)
+
+const (
+	DEFAULTQUERIESPERSECOND float64 = 5
+	// DEFAULTRATELIMITBURST spaces the queries evenly
+	DEFAULTRATELIMITBURST float64 = 1
+)
+
+// RateLimiter is a token bucket refilled at a number of queries per second
+type RateLimiter struct {
+	queriesPerSecond float64
+	burst            float64
+	tokens           float64
+	last             time.Time
+	mutex            sync.Mutex
+}
+
+func NewRateLimiter(queriesPerSecond float64, burst float64) *RateLimiter {
+	return &RateLimiter{
+		queriesPerSecond: queriesPerSecond,
+		burst:            burst,
+		tokens:           burst,
+		last:             time.Now(),
+	}
+}
+
+// Wait blocks until a query can be sent or the context is done, a nil
+// limiter never blocks.
+func (limiter *RateLimiter) Wait(ctx context.Context) error {
+	if limiter == nil || ctx.Err() != nil {
+		return ctx.Err()
+	}
+	limiter.mutex.Lock()
+	now := time.Now()
+	limiter.tokens = math.Min(limiter.burst, limiter.tokens+now.Sub(limiter.last).Seconds()*limiter.queriesPerSecond)
+	limiter.last = now
+	// the token is taken now, the callers queued behind wait for their own
+	limiter.tokens--
+	wait := time.Duration(-limiter.tokens / limiter.queriesPerSecond * float64(time.Second))
+	limiter.mutex.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// the query is not sent, its token goes back to the callers coming next
+		limiter.mutex.Lock()
+		limiter.tokens++
+		limiter.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// RateLimiters shares a rate limiter between all the bots querying the same
+// search endpoint for the same org.
+type RateLimiters struct {
+	queriesPerSecond      float64
+	queriesPerSecondByOrg map[string]float64
+	limiters              map[string]*RateLimiter
+	mutex                 sync.Mutex
+}
+
+// NewRateLimiters limits every org to queriesPerSecond unless it has its own
+// rate, a rate of 0 does not limit the org.
+func NewRateLimiters(queriesPerSecond float64, queriesPerSecondByOrg map[string]float64) *RateLimiters {
+	return &RateLimiters{
+		queriesPerSecond:      queriesPerSecond,
+		queriesPerSecondByOrg: queriesPerSecondByOrg,
+		limiters:              make(map[string]*RateLimiter),
+	}
+}
+
+// For returns the limiter of an org on a search endpoint, nil if it is not limited
+func (limiters *RateLimiters) For(endpoint string, org string) *RateLimiter {
+	if limiters == nil {
+		return nil
+	}
+	queriesPerSecond, ok := limiters.queriesPerSecondByOrg[org]
+	if !ok {
+		queriesPerSecond = limiters.queriesPerSecond
+	}
+	if queriesPerSecond <= 0 {
+		return nil
+	}
+	limiters.mutex.Lock()
+	defer limiters.mutex.Unlock()
+	key := endpoint + "|" + org
+	limiter, ok := limiters.limiters[key]
+	if !ok {
+		limiter = NewRateLimiter(queriesPerSecond, DEFAULTRATELIMITBURST)
+		limiters.limiters[key] = limiter
+	}
+	return limiter
+}
+
+// ParseQueriesPerSecondByOrg reads rates written as org1=10,org2=2.5
+func ParseQueriesPerSecondByOrg(value string) (map[string]float64, error) {
+	queriesPerSecondByOrg := make(map[string]float64)
+	if value == "" {
+		return queriesPerSecondByOrg, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid rate %q, should be org=queriesPerSecond", pair)
+		}
+		queriesPerSecond, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || queriesPerSecond < 0 {
+			return nil, fmt.Errorf("Invalid rate %q, should be org=queriesPerSecond", pair)
+		}
+		queriesPerSecondByOrg[parts[0]] = queriesPerSecond
+	}
+	return queriesPerSecondByOrg, nil
+}
+
+// limitedClient waits for the rate limiter before every search request
+type limitedClient struct {
+	SearchClient
+	limiter *RateLimiter
+}
+
+func (client limitedClient) Query(ctx context.Context, query search.Query) (*search.Response, error) {
+	err := client.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.SearchClient.Query(ctx, query)
+}
+
+func (client limitedClient) ListFacetValues(ctx context.Context, field string, maximumNumberOfValues int) (*search.FacetValues, error) {
+	err := client.limiter.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.SearchClient.ListFacetValues(ctx, field, maximumNumberOfValues)
+}
@@ -0,0 +1,143 @@
+package explorerlib
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSpacesConcurrentCallers(t *testing.T) {
+	limiter := NewRateLimiter(100, 1)
+	callers := 11
+	start := time.Now()
+	var group sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			err := limiter.Wait(context.Background())
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	group.Wait()
+	// the first caller goes right away, the next ones every 10ms
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("%v callers at 100 queries per second took %v, want at least 100ms", callers, elapsed)
+	}
+}
+
+func TestRateLimiterGivesBackTheTokenOfACanceledCaller(t *testing.T) {
+	limiter := NewRateLimiter(10, 1)
+	err := limiter.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the bucket is empty, the next callers wait 100ms then 200ms
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- limiter.Wait(ctx) }()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Wait of a canceled caller = %v, want %v", err, context.Canceled)
+	}
+
+	start := time.Now()
+	err = limiter.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without the refund the caller would wait for the slot after the canceled one
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("the caller after a canceled one waited %v, want at most 100ms", elapsed)
+	}
+}
+
+func TestRateLimiterDoesNotTakeATokenForADoneContext(t *testing.T) {
+	limiter := NewRateLimiter(10, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); err != context.Canceled {
+		t.Fatalf("Wait with a done context = %v, want %v", err, context.Canceled)
+	}
+	start := time.Now()
+	limiter.Wait(context.Background())
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("the first caller with a live context waited %v", elapsed)
+	}
+}
+
+func TestNilRateLimiterNeverBlocks(t *testing.T) {
+	var limiter *RateLimiter
+	for i := 0; i < 100; i++ {
+		err := limiter.Wait(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRateLimitersAreSharedByOrg(t *testing.T) {
+	limiters := NewRateLimiters(5, map[string]float64{"fast": 50, "free": 0})
+
+	if limiters.For("endpoint", "org") != limiters.For("endpoint", "org") {
+		t.Error("the bots of an org on an endpoint should share a limiter")
+	}
+	if limiters.For("endpoint", "org") == limiters.For("endpoint", "other") {
+		t.Error("two orgs should not share a limiter")
+	}
+	if limiters.For("endpoint", "org") == limiters.For("other", "org") {
+		t.Error("an org on two endpoints should not share a limiter")
+	}
+	if limiter := limiters.For("endpoint", "fast"); limiter.queriesPerSecond != 50 {
+		t.Errorf("the limiter of an org with its own rate has %v queries per second, want 50", limiter.queriesPerSecond)
+	}
+	if limiter := limiters.For("endpoint", "free"); limiter != nil {
+		t.Error("an org with a rate of 0 should not be limited")
+	}
+	var none *RateLimiters
+	if none.For("endpoint", "org") != nil {
+		t.Error("nil limiters should not limit")
+	}
+}
+
+func TestRateLimitersAreSafeForConcurrentBots(t *testing.T) {
+	limiters := NewRateLimiters(1000, nil)
+	found := make(chan *RateLimiter, 20)
+	var group sync.WaitGroup
+	for i := 0; i < cap(found); i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			limiter := limiters.For("endpoint", "org")
+			limiter.Wait(context.Background())
+			found <- limiter
+		}()
+	}
+	group.Wait()
+	close(found)
+	first := <-found
+	for limiter := range found {
+		if limiter != first {
+			t.Fatal("concurrent bots of an org got different limiters")
+		}
+	}
+}
+
+func TestParseQueriesPerSecondByOrg(t *testing.T) {
+	rates, err := ParseQueriesPerSecondByOrg("org1=10,org2=2.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["org1"] != 10 || rates["org2"] != 2.5 {
+		t.Errorf("rates = %v", rates)
+	}
+	for _, value := range []string{"org1", "=2", "org1=-1", "org1=fast"} {
+		if _, err := ParseQueriesPerSecondByOrg(value); err == nil {
+			t.Errorf("%q should not parse", value)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package explorerlib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/coveo/uabot/scenariolib"
+)
+
+const (
+	SEARCHEVENTTEMPLATE string = "search"
+	CLICKEVENTTEMPLATE  string = "click"
+	VIEWEVENTTEMPLATE   string = "view"
+	ORIGINEVENTTEMPLATE string = "origin"
+
+	MAXIMUMEVENTREPEAT int = 100
+)
+
+// EventTemplate describes an event of a ScenarioTemplate
+type EventTemplate struct {
+	Type string `json:"type"`
+	// Probability of a click or a view, 1 if not provided
+	Probability *float64 `json:"probability"`
+	// LogEvent tells if a search is sent to the analytics, true if not provided
+	LogEvent *bool `json:"logEvent"`
+	// Offset of the document viewed in the last results
+	Offset int `json:"offset"`
+	// Repeat the event this many times, once if not provided
+	Repeat int `json:"repeat"`
+}
+
+// ScenarioTemplate is a scenario expanded by the bot for every language and
+// origin level. An origin event is added at the start if the template has none.
+type ScenarioTemplate struct {
+	Name string `json:"name"`
+	// Weight multiplies the number of documents in the language of the scenario, 1 if not provided
+	Weight int             `json:"weight"`
+	Events []EventTemplate `json:"events"`
+}
+
+func (template EventTemplate) Validate() error {
+	switch strings.ToLower(template.Type) {
+	case SEARCHEVENTTEMPLATE, CLICKEVENTTEMPLATE, VIEWEVENTTEMPLATE, ORIGINEVENTTEMPLATE:
+	default:
+		return fmt.Errorf("Unknown event type %q, should be one of search, click, view or origin", template.Type)
+	}
+	if template.Probability != nil && (*template.Probability < 0 || *template.Probability > 1) {
+		return errors.New("Event probability should be in [0,1]")
+	}
+	if template.Offset < 0 {
+		return errors.New("Event offset should be positive")
+	}
+	if template.Repeat < 0 || template.Repeat > MAXIMUMEVENTREPEAT {
+		return fmt.Errorf("Event repeat should be in [0,%v]", MAXIMUMEVENTREPEAT)
+	}
+	return nil
+}
+
+func (template ScenarioTemplate) Validate() error {
+	if template.Name == "" {
+		return errors.New("Scenario name Missing")
+	}
+	if template.Weight < 0 {
+		return errors.New("Scenario weight should be positive for scenario: " + template.Name)
+	}
+	if len(template.Events) == 0 {
+		return errors.New("Scenario events Missing for scenario: " + template.Name)
+	}
+	for _, event := range template.Events {
+		if err := event.Validate(); err != nil {
+			return errors.New(err.Error() + " in scenario: " + template.Name)
+		}
+	}
+	return nil
+}
+
+func (template EventTemplate) build(originLevel1 string, originLevel2 string) scenariolib.JSONEvent {
+	probability := 1.0
+	if template.Probability != nil {
+		probability = *template.Probability
+	}
+	switch strings.ToLower(template.Type) {
+	case SEARCHEVENTTEMPLATE:
+		logEvent := true
+		if template.LogEvent != nil {
+			logEvent = *template.LogEvent
+		}
+		return NewSearchEvent(logEvent)
+	case CLICKEVENTTEMPLATE:
+		return NewClickEvent(probability)
+	case VIEWEVENTTEMPLATE:
+		event := NewViewEvent(template.Offset)
+		event.Arguments["probability"] = probability
+		return event
+	}
+	return NewSetOriginLevels(originLevel1, originLevel2)
+}
+
+// Build expands the template into a scenario in a language for an origin level
+func (template ScenarioTemplate) Build(language string, languageWeight int, originLevel1 string, originLevel2 string) *scenariolib.Scenario {
+	weight := template.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	builder := NewScenarioBuilder().
+		WithName(template.Name + " in " + language).
+		WithWeight(languageWeight * weight).
+		WithLanguage(LanguageToTag(language))
+	if !template.hasOriginEvent() {
+		builder.WithEvent(NewSetOriginLevels(originLevel1, originLevel2))
+	}
+	for _, event := range template.Events {
+		repeat := event.Repeat
+		if repeat == 0 {
+			repeat = 1
+		}
+		for i := 0; i < repeat; i++ {
+			builder.WithEvent(event.build(originLevel1, originLevel2))
+		}
+	}
+	return builder.Build()
+}
+
+func (template ScenarioTemplate) hasOriginEvent() bool {
+	for _, event := range template.Events {
+		if strings.ToLower(event.Type) == ORIGINEVENTTEMPLATE {
+			return true
+		}
+	}
+	return false
+}
+
+func withProbability(value float64) *float64 {
+	return &value
+}
+
+var noLog = false
+
+// searchAndClicks is a search followed by two chances to click, with a view
+// after the search and the clicks if withViews is true
+func searchAndClicks(withViews bool) []EventTemplate {
+	events := []EventTemplate{{Type: SEARCHEVENTTEMPLATE}}
+	if withViews {
+		events = append(events, EventTemplate{Type: VIEWEVENTTEMPLATE})
+	}
+	return append(events,
+		EventTemplate{Type: CLICKEVENTTEMPLATE, Probability: withProbability(0.5)},
+		EventTemplate{Type: CLICKEVENTTEMPLATE, Probability: withProbability(0.8)})
+}
+
+// DefaultScenarioTemplates are the scenarios used when a bot is started without any
+func DefaultScenarioTemplates() []ScenarioTemplate {
+	templates := []ScenarioTemplate{}
+	//Five scenarios with 1 to 5 search and a click event
+	for searches := 1; searches <= 5; searches++ {
+		events := []EventTemplate{}
+		for i := 0; i < searches; i++ {
+			events = append(events, searchAndClicks(false)...)
+		}
+		templates = append(templates, ScenarioTemplate{
+			Name:   fmt.Sprintf("%v search and click", searches),
+			Events: events,
+		})
+	}
+
+	//20 page view event with a search event, no click
+	templates = append(templates, ScenarioTemplate{
+		Name: "views",
+		Events: []EventTemplate{
+			{Type: SEARCHEVENTTEMPLATE, LogEvent: &noLog},
+			{Type: VIEWEVENTTEMPLATE, Repeat: 20},
+		},
+	})
+
+	//Five scenarios with 1 to 5 search and click event, with View Event following search and click
+	for searches := 1; searches <= 5; searches++ {
+		events := []EventTemplate{}
+		for i := 0; i < searches; i++ {
+			// the fourth search of the longer scenarios is not followed by views
+			events = append(events, searchAndClicks(i != 3)...)
+		}
+		if searches == 1 {
+			events = append(events, EventTemplate{Type: VIEWEVENTTEMPLATE})
+		}
+		templates = append(templates, ScenarioTemplate{
+			Name:   fmt.Sprintf("%v search and click and pageview", searches),
+			Events: events,
+		})
+	}
+	return templates
+}
@@ -0,0 +1,182 @@
+package explorerlib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/coveo/go-coveo/search"
+)
+
+// Modes of the search archive of a job
+const (
+	// RECORDARCHIVE writes every search request of the exploration and its response to the archive
+	RECORDARCHIVE string = "record"
+	// REPLAYARCHIVE answers the search requests from the archive without reaching the index
+	REPLAYARCHIVE string = "replay"
+
+	// Kinds of the archived requests
+	QUERYKIND string = "query"
+	FACETKIND string = "facet"
+)
+
+// ArchivedSearch is a search request and its response, a line of the archive
+type ArchivedSearch struct {
+	Kind string `json:"kind"`
+	// Query is set for the query requests
+	Query *search.Query `json:"query,omitempty"`
+	// Field and MaximumNumberOfValues are set for the facet requests
+	Field                 string              `json:"field,omitempty"`
+	MaximumNumberOfValues int                 `json:"maximumNumberOfValues,omitempty"`
+	Response              *search.Response    `json:"response,omitempty"`
+	Values                *search.FacetValues `json:"values,omitempty"`
+}
+
+// NotArchivedError is returned when replaying a request the archive does not have
+type NotArchivedError struct {
+	Request string
+}
+
+func (err *NotArchivedError) Error() string {
+	return fmt.Sprintf("Search request not found in the archive: %v", err.Request)
+}
+
+func (archived ArchivedSearch) key() (string, error) {
+	if archived.Query != nil {
+		query, err := json.Marshal(archived.Query)
+		return archived.Kind + " " + string(query), err
+	}
+	return archived.Kind + " " + archived.Field + " " + strconv.Itoa(archived.MaximumNumberOfValues), nil
+}
+
+// Recording returns the index writing every request it sends and the response
+// to the archive file, created with its directory or truncated, and a function
+// closing the file.
+func (index Index) Recording(path string) (Index, func() error, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return index, nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return index, nil, err
+	}
+	writer := bufio.NewWriter(file)
+	client := &recordingClient{SearchClient: index.Client, encoder: json.NewEncoder(writer)}
+	closeArchive := func() error {
+		client.mutex.Lock()
+		defer client.mutex.Unlock()
+		err := writer.Flush()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+	return Index{Client: client}, closeArchive, nil
+}
+
+// NewReplayIndex creates an index answering from an archive recorded earlier,
+// a request sent several times gets the responses in the order they were
+// recorded, then the last one again.
+func NewReplayIndex(path string) (Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Index{}, err
+	}
+	defer file.Close()
+	client := &replayClient{searches: make(map[string][]ArchivedSearch)}
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		archived := ArchivedSearch{}
+		err = decoder.Decode(&archived)
+		if err != nil {
+			return Index{}, err
+		}
+		key, err := archived.key()
+		if err != nil {
+			return Index{}, err
+		}
+		client.searches[key] = append(client.searches[key], archived)
+	}
+	return Index{Client: client}, nil
+}
+
+// recordingClient writes the requests sent and their responses, one JSON object per line
+type recordingClient struct {
+	SearchClient
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+func (client *recordingClient) record(archived ArchivedSearch) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	return client.encoder.Encode(archived)
+}
+
+func (client *recordingClient) Query(ctx context.Context, query search.Query) (*search.Response, error) {
+	response, err := client.SearchClient.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return response, client.record(ArchivedSearch{Kind: QUERYKIND, Query: &query, Response: response})
+}
+
+func (client *recordingClient) ListFacetValues(ctx context.Context, field string, maximumNumberOfValues int) (*search.FacetValues, error) {
+	values, err := client.SearchClient.ListFacetValues(ctx, field, maximumNumberOfValues)
+	if err != nil {
+		return nil, err
+	}
+	return values, client.record(ArchivedSearch{Kind: FACETKIND, Field: field, MaximumNumberOfValues: maximumNumberOfValues, Values: values})
+}
+
+// replayClient serves the archived responses, a request is matched on all its parameters
+type replayClient struct {
+	searches map[string][]ArchivedSearch
+	mutex    sync.Mutex
+}
+
+func (client *replayClient) next(request ArchivedSearch) (ArchivedSearch, error) {
+	key, err := request.key()
+	if err != nil {
+		return request, err
+	}
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	searches := client.searches[key]
+	if len(searches) == 0 {
+		return request, &NotArchivedError{Request: key}
+	}
+	if len(searches) > 1 {
+		client.searches[key] = searches[1:]
+	}
+	return searches[0], nil
+}
+
+func (client *replayClient) Query(ctx context.Context, query search.Query) (*search.Response, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	archived, err := client.next(ArchivedSearch{Kind: QUERYKIND, Query: &query})
+	if err != nil {
+		return nil, err
+	}
+	return archived.Response, nil
+}
+
+func (client *replayClient) ListFacetValues(ctx context.Context, field string, maximumNumberOfValues int) (*search.FacetValues, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	archived, err := client.next(ArchivedSearch{Kind: FACETKIND, Field: field, MaximumNumberOfValues: maximumNumberOfValues})
+	if err != nil {
+		return nil, err
+	}
+	return archived.Values, nil
+}
@@ -0,0 +1,256 @@
+package explorerlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/coveo/go-coveo/search"
+)
+
+const (
+	DEFAULTSEARCHTIMEOUT    time.Duration = 30 * time.Second
+	DEFAULTSEARCHRETRIES    int           = 3
+	DEFAULTSEARCHBACKOFF    time.Duration = 500 * time.Millisecond
+	DEFAULTSEARCHMAXBACKOFF time.Duration = 30 * time.Second
+
+	// MAXIMUMERRORBODYLENGTH is how much of the body of a failed response is kept in the error
+	MAXIMUMERRORBODYLENGTH int64 = 1024
+
+	// SEARCHUSERAGENT is the user agent of the requests sent to the search API
+	SEARCHUSERAGENT string = "uabot-server"
+)
+
+// SearchClient sends the requests of the explorer to the search API, a
+// request is aborted as soon as its context is done.
+type SearchClient interface {
+	Query(ctx context.Context, query search.Query) (*search.Response, error)
+	ListFacetValues(ctx context.Context, field string, maximumNumberOfValues int) (*search.FacetValues, error)
+}
+
+// SearchError is returned when the search API answers with an error status
+type SearchError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is how long the search API asked to wait, 0 if it did not
+	RetryAfter time.Duration
+}
+
+func (err *SearchError) Error() string {
+	return fmt.Sprintf("Search API returned %v %v: %v", err.StatusCode, http.StatusText(err.StatusCode), err.Body)
+}
+
+// Temporary tells if the request can succeed when sent again
+func (err *SearchError) Temporary() bool {
+	return err.StatusCode == http.StatusTooManyRequests || err.StatusCode >= 500
+}
+
+// RetryPolicy tells how long a search request can take and how the requests
+// failing with a temporary error are sent again.
+type RetryPolicy struct {
+	// Timeout of every attempt, no timeout if 0
+	Timeout time.Duration
+	// Retries is the number of attempts after the first one
+	Retries int
+	// Backoff is the wait before the first retry, doubled at every retry up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Timeout:    DEFAULTSEARCHTIMEOUT,
+		Retries:    DEFAULTSEARCHRETRIES,
+		Backoff:    DEFAULTSEARCHBACKOFF,
+		MaxBackoff: DEFAULTSEARCHMAXBACKOFF,
+	}
+}
+
+// wait returns how long to wait before the retry, between half and all of the
+// backoff so the bots failing together do not retry together, unless the
+// search API asked for a specific delay. The wait is never longer than
+// MaxBackoff.
+func (policy RetryPolicy) wait(retry int, err error) time.Duration {
+	if searchError, ok := err.(*SearchError); ok && searchError.RetryAfter > 0 {
+		if searchError.RetryAfter > policy.MaxBackoff {
+			return policy.MaxBackoff
+		}
+		return searchError.RetryAfter
+	}
+	backoff := policy.Backoff << uint(retry)
+	if backoff > policy.MaxBackoff || backoff <= 0 {
+		backoff = policy.MaxBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// do calls attempt until it succeeds, fails with an error that is not
+// temporary or runs out of retries.
+func (policy RetryPolicy) do(ctx context.Context, attempt func() error) error {
+	for retry := 0; ; retry++ {
+		err := attempt()
+		if err == nil || !isTemporary(ctx, err) || retry >= policy.Retries {
+			return err
+		}
+		timer := time.NewTimer(policy.wait(retry, err))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// NewSearchClient returns a client of the search API, on the production
+// endpoint if none is given. It sends every request once, within the timeout
+// of the policy.
+func NewSearchClient(endpoint string, token string, policy RetryPolicy) SearchClient {
+	if endpoint == "" {
+		endpoint = search.EndpointProduction
+	}
+	return &httpSearchClient{
+		httpClient: &http.Client{Timeout: policy.Timeout},
+		endpoint:   endpoint,
+		token:      token,
+	}
+}
+
+type httpSearchClient struct {
+	httpClient *http.Client
+	endpoint   string
+	token      string
+}
+
+func (client *httpSearchClient) Query(ctx context.Context, query search.Query) (*search.Response, error) {
+	marshalledQuery, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	response := &search.Response{}
+	err = client.send(ctx, func() (*http.Request, error) {
+		request, err := http.NewRequest("POST", client.endpoint, bytes.NewReader(marshalledQuery))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Add("Content-Type", "application/json")
+		request.Header.Add("Accepts", "application/json")
+		return request, nil
+	}, response)
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (client *httpSearchClient) ListFacetValues(ctx context.Context, field string, maximumNumberOfValues int) (*search.FacetValues, error) {
+	valuesUrl, err := url.Parse(client.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	parameters := valuesUrl.Query()
+	parameters.Set("field", field)
+	parameters.Set("maximumNumberOfValues", strconv.Itoa(maximumNumberOfValues))
+	valuesUrl.RawQuery = parameters.Encode()
+	valuesUrl.Path = valuesUrl.Path + "values"
+
+	values := &search.FacetValues{}
+	err = client.send(ctx, func() (*http.Request, error) {
+		return http.NewRequest("GET", valuesUrl.String(), nil)
+	}, values)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// send sends the request built by newRequest and decodes the JSON response into result
+func (client *httpSearchClient) send(ctx context.Context, newRequest func() (*http.Request, error), result interface{}) error {
+	request, err := newRequest()
+	if err != nil {
+		return err
+	}
+	request.Header.Add("Authorization", "Bearer "+client.token)
+	request.Header.Set("User-Agent", SEARCHUSERAGENT)
+	response, err := client.httpClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(&io.LimitedReader{R: response.Body, N: MAXIMUMERRORBODYLENGTH})
+		return &SearchError{
+			StatusCode: response.StatusCode,
+			Body:       string(body),
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// isTemporary tells if a failed request should be sent again, the network
+// errors are unless the request was canceled.
+func isTemporary(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	switch err := err.(type) {
+	case *SearchError:
+		return err.Temporary()
+	case *url.Error:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as a date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// retryingClient sends again the requests failing with a temporary error,
+// every attempt goes through the client it wraps, its rate limiter and its
+// metrics included.
+type retryingClient struct {
+	SearchClient
+	policy RetryPolicy
+}
+
+func (client retryingClient) Query(ctx context.Context, query search.Query) (*search.Response, error) {
+	var response *search.Response
+	err := client.policy.do(ctx, func() error {
+		var err error
+		response, err = client.SearchClient.Query(ctx, query)
+		return err
+	})
+	return response, err
+}
+
+func (client retryingClient) ListFacetValues(ctx context.Context, field string, maximumNumberOfValues int) (*search.FacetValues, error) {
+	var values *search.FacetValues
+	err := client.policy.do(ctx, func() error {
+		var err error
+		values, err = client.SearchClient.ListFacetValues(ctx, field, maximumNumberOfValues)
+		return err
+	})
+	return values, err
+}
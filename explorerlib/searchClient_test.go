@@ -0,0 +1,79 @@
+package explorerlib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":        0,
+		"0":       0,
+		"-5":      0,
+		"garbage": 0,
+		"3":       3 * time.Second,
+		"120":     2 * time.Minute,
+		// a date in the past
+		"Wed, 21 Oct 2015 07:28:00 GMT": 0,
+	} {
+		if got := parseRetryAfter(value); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(date); got <= 50*time.Second || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, want about a minute", date, got)
+	}
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	policy := RetryPolicy{Retries: 3, Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for retry, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		got := policy.wait(retry, errors.New("failed"))
+		if got < backoff/2 || got > backoff {
+			t.Errorf("wait before retry %v = %v, want between %v and %v", retry, got, backoff/2, backoff)
+		}
+	}
+	if got := policy.wait(0, &SearchError{StatusCode: http.StatusTooManyRequests, RetryAfter: 3 * time.Second}); got != 3*time.Second {
+		t.Errorf("wait with a Retry-After of 3s = %v, want 3s", got)
+	}
+	if got := policy.wait(0, &SearchError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}); got != policy.MaxBackoff {
+		t.Errorf("wait with a Retry-After of an hour = %v, want %v", got, policy.MaxBackoff)
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{Retries: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	attempts := 0
+	err := policy.do(context.Background(), func() error {
+		attempts++
+		return &SearchError{StatusCode: http.StatusServiceUnavailable}
+	})
+	if err == nil || attempts != 3 {
+		t.Errorf("temporary errors: %v attempts and error %v, want 3 attempts and an error", attempts, err)
+	}
+
+	attempts = 0
+	err = policy.do(context.Background(), func() error {
+		attempts++
+		return &SearchError{StatusCode: http.StatusBadRequest}
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("error that is not temporary: %v attempts and error %v, want 1 attempt and an error", attempts, err)
+	}
+
+	attempts = 0
+	err = policy.do(context.Background(), func() error {
+		attempts++
+		if attempts < 2 {
+			return &SearchError{StatusCode: http.StatusTooManyRequests}
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("success after a retry: %v attempts and error %v, want 2 attempts and no error", attempts, err)
+	}
+}
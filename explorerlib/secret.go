@@ -0,0 +1,26 @@
+package explorerlib
+
+import (
+	"encoding/json"
+)
+
+const REDACTED string = "********"
+
+// Secret is a string, like a token, that is never shown in JSON or in logs.
+// Use string(secret) where the real value is needed.
+type Secret string
+
+func (secret Secret) MarshalJSON() ([]byte, error) {
+	if secret == "" {
+		return json.Marshal("")
+	}
+	return json.Marshal(REDACTED)
+}
+
+func (secret Secret) String() string {
+	return REDACTED
+}
+
+func (secret Secret) GoString() string {
+	return REDACTED
+}
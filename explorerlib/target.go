@@ -0,0 +1,156 @@
+package explorerlib
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Target is the volume of analytics a bot sends, the bot paces its visits to
+// send them at the target rate and stops once it has sent its budget.
+type Target struct {
+	VisitsPerMinute float64 `json:"visitsPerMinute,omitempty"`
+	EventsPerMinute float64 `json:"eventsPerMinute,omitempty"`
+	// Visits and Events are the budget of the bot, without a rate it is spread over its time to live
+	Visits int `json:"visits,omitempty"`
+	Events int `json:"events,omitempty"`
+	// EventType is the type of the events counted, search, click, view or custom, every type if empty
+	EventType string `json:"eventType,omitempty"`
+}
+
+// TargetCounts are the visits and events a bot actually sent
+type TargetCounts struct {
+	Visits int `json:"visits"`
+	Events int `json:"events"`
+}
+
+// Validate checks the target has a rate or a budget that makes sense
+func (target *Target) Validate() error {
+	switch target.EventType {
+	case "", "search", "click", "view", "custom":
+	default:
+		return fmt.Errorf("Unknown target eventType %q, should be search, click, view or custom", target.EventType)
+	}
+	if target.VisitsPerMinute < 0 || target.EventsPerMinute < 0 || target.Visits < 0 || target.Events < 0 {
+		return errors.New("Target rates and budgets should be positive")
+	}
+	if target.VisitsPerMinute > 0 && target.EventsPerMinute > 0 {
+		return errors.New("Target should have a rate of visitsPerMinute or eventsPerMinute, not both")
+	}
+	if !target.HasRate() && !target.HasBudget() {
+		return errors.New("Target should have a rate or a budget of visits or events")
+	}
+	return nil
+}
+
+func (target *Target) HasRate() bool {
+	return target.VisitsPerMinute > 0 || target.EventsPerMinute > 0
+}
+
+func (target *Target) HasBudget() bool {
+	return target.Visits > 0 || target.Events > 0
+}
+
+// Counts tells if an event of the type counts toward the target
+func (target *Target) Counts(eventType string) bool {
+	return target.EventType == "" || target.EventType == eventType
+}
+
+// TargetPacer counts what a bot sends, spaces its visits to send them at the
+// target rate and tells when the budget is reached.
+type TargetPacer struct {
+	target *Target
+	// the rate is kept from the start, counts included, so a slow bot catches up
+	start       time.Time
+	startCounts TargetCounts
+	counts      TargetCounts
+	// visits or events per minute, 0 to send as fast as possible
+	visitsPerMinute float64
+	eventsPerMinute float64
+	reached         chan bool
+	mutex           sync.Mutex
+}
+
+// NewTargetPacer paces a bot that already sent the given counts, a target
+// with a budget but no rate is spread evenly until the deadline, if any.
+func NewTargetPacer(target *Target, counts TargetCounts, start time.Time, deadline time.Time) *TargetPacer {
+	pacer := &TargetPacer{
+		target:          target,
+		start:           start,
+		startCounts:     counts,
+		counts:          counts,
+		visitsPerMinute: target.VisitsPerMinute,
+		eventsPerMinute: target.EventsPerMinute,
+		reached:         make(chan bool),
+	}
+	if !target.HasRate() && !deadline.IsZero() && deadline.After(start) {
+		minutes := deadline.Sub(start).Minutes()
+		if target.Visits > 0 {
+			pacer.visitsPerMinute = float64(target.Visits-counts.Visits) / minutes
+		} else {
+			pacer.eventsPerMinute = float64(target.Events-counts.Events) / minutes
+		}
+	}
+	if pacer.isReached() {
+		close(pacer.reached)
+	}
+	return pacer
+}
+
+// Reached is closed once the bot has sent its budget
+func (pacer *TargetPacer) Reached() <-chan bool {
+	return pacer.reached
+}
+
+func (pacer *TargetPacer) isReached() bool {
+	return (pacer.target.Visits > 0 && pacer.counts.Visits >= pacer.target.Visits) ||
+		(pacer.target.Events > 0 && pacer.counts.Events >= pacer.target.Events)
+}
+
+func (pacer *TargetPacer) count(add func(counts *TargetCounts)) {
+	pacer.mutex.Lock()
+	defer pacer.mutex.Unlock()
+	wasReached := pacer.isReached()
+	add(&pacer.counts)
+	if !wasReached && pacer.isReached() {
+		close(pacer.reached)
+	}
+}
+
+// VisitStarted counts a visit of the bot
+func (pacer *TargetPacer) VisitStarted() {
+	pacer.count(func(counts *TargetCounts) { counts.Visits++ })
+}
+
+// EventSent counts an event of the bot if its type counts toward the target
+func (pacer *TargetPacer) EventSent(eventType string) {
+	if !pacer.target.Counts(eventType) {
+		return
+	}
+	pacer.count(func(counts *TargetCounts) { counts.Events++ })
+}
+
+func (pacer *TargetPacer) Counts() TargetCounts {
+	pacer.mutex.Lock()
+	defer pacer.mutex.Unlock()
+	return pacer.counts
+}
+
+// Next returns the time of the next visit, the time the visits or events
+// sent since the start should have taken at the target rate.
+func (pacer *TargetPacer) Next(now time.Time) time.Time {
+	pacer.mutex.Lock()
+	defer pacer.mutex.Unlock()
+	var minutes float64
+	if pacer.visitsPerMinute > 0 {
+		minutes = float64(pacer.counts.Visits-pacer.startCounts.Visits) / pacer.visitsPerMinute
+	} else if pacer.eventsPerMinute > 0 {
+		minutes = float64(pacer.counts.Events-pacer.startCounts.Events) / pacer.eventsPerMinute
+	}
+	next := pacer.start.Add(time.Duration(minutes * float64(time.Minute)))
+	if next.Before(now) {
+		return now
+	}
+	return next
+}
@@ -0,0 +1,90 @@
+package explorerlib
+
+import (
+	"testing"
+	"time"
+)
+
+func isClosed(channel <-chan bool) bool {
+	select {
+	case <-channel:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestTargetPacerSpacesTheVisitsAtTheRate(t *testing.T) {
+	start := time.Now()
+	pacer := NewTargetPacer(&Target{VisitsPerMinute: 2}, TargetCounts{}, start, time.Time{})
+	if got := pacer.Next(start); !got.Equal(start) {
+		t.Errorf("first visit at %v, want %v", got, start)
+	}
+	pacer.VisitStarted()
+	pacer.VisitStarted()
+	if got, want := pacer.Next(start), start.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("third visit at %v, want %v", got, want)
+	}
+	// a bot running late does not wait
+	late := start.Add(5 * time.Minute)
+	if got := pacer.Next(late); !got.Equal(late) {
+		t.Errorf("late visit at %v, want %v", got, late)
+	}
+}
+
+func TestTargetPacerSpreadsTheBudgetUntilTheDeadline(t *testing.T) {
+	start := time.Now()
+	// 10 of the 70 events are already sent, the 60 left are spread over an hour
+	pacer := NewTargetPacer(&Target{Events: 70, EventType: "search"}, TargetCounts{Events: 10}, start, start.Add(time.Hour))
+	for i := 0; i < 30; i++ {
+		pacer.EventSent("search")
+		pacer.EventSent("click")
+	}
+	if got, want := pacer.Next(start), start.Add(30*time.Minute); !got.Equal(want) {
+		t.Errorf("next visit at %v, want %v", got, want)
+	}
+	if got := pacer.Counts(); got.Events != 40 {
+		t.Errorf("counted %v events, want 40", got.Events)
+	}
+}
+
+func TestTargetPacerReached(t *testing.T) {
+	pacer := NewTargetPacer(&Target{Visits: 2}, TargetCounts{Visits: 1}, time.Now(), time.Time{})
+	if isClosed(pacer.Reached()) {
+		t.Fatal("budget reached before the last visit")
+	}
+	pacer.VisitStarted()
+	if !isClosed(pacer.Reached()) {
+		t.Fatal("budget not reached after the last visit")
+	}
+	// counting past the budget does not close the channel twice
+	pacer.VisitStarted()
+
+	resumed := NewTargetPacer(&Target{Visits: 2}, TargetCounts{Visits: 2}, time.Now(), time.Time{})
+	if !isClosed(resumed.Reached()) {
+		t.Error("budget of a resumed bot that already sent it not reached")
+	}
+}
+
+func TestTargetValidate(t *testing.T) {
+	for _, target := range []Target{
+		{},
+		{EventType: "search"},
+		{Visits: -1},
+		{VisitsPerMinute: 1, EventsPerMinute: 1},
+		{Events: 10, EventType: "unknown"},
+	} {
+		if err := target.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", target)
+		}
+	}
+	for _, target := range []Target{
+		{VisitsPerMinute: 1},
+		{Events: 10, EventType: "click"},
+		{EventsPerMinute: 5, Visits: 100},
+	} {
+		if err := target.Validate(); err != nil {
+			t.Errorf("Validate(%+v) failed: %v", target, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package explorerlib
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Presets of the traffic profiles
+const (
+	// FLATTRAFFIC visits at the same rate all the time
+	FLATTRAFFIC string = "flat"
+	// BUSINESSHOURSTRAFFIC visits mostly on weekdays from 9 to 5, like an intranet or a support portal
+	BUSINESSHOURSTRAFFIC string = "business-hours"
+	// RETAILTRAFFIC visits all the time, mostly in the evening and on weekends, like a store
+	RETAILTRAFFIC string = "retail-24-7"
+
+	DEFAULTVISITSPERHOUR float64 = 60
+	MAXIMUMVISITSPERHOUR float64 = 3600
+)
+
+type trafficCurves struct {
+	hourly []float64
+	daily  []float64
+}
+
+var trafficPresets = map[string]trafficCurves{
+	FLATTRAFFIC: {
+		hourly: []float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+		daily:  []float64{1, 1, 1, 1, 1, 1, 1},
+	},
+	BUSINESSHOURSTRAFFIC: {
+		hourly: []float64{0.02, 0.02, 0.02, 0.02, 0.02, 0.03, 0.05, 0.2, 0.6, 1, 1, 1, 0.7, 1, 1, 1, 0.9, 0.6, 0.3, 0.1, 0.1, 0.08, 0.05, 0.03},
+		daily:  []float64{0.1, 1, 1, 1, 1, 0.9, 0.1},
+	},
+	RETAILTRAFFIC: {
+		hourly: []float64{0.3, 0.2, 0.15, 0.1, 0.1, 0.1, 0.15, 0.25, 0.4, 0.5, 0.6, 0.7, 0.8, 0.75, 0.7, 0.7, 0.75, 0.8, 0.9, 1, 1, 0.9, 0.7, 0.5},
+		daily:  []float64{1, 0.7, 0.7, 0.75, 0.8, 0.9, 1},
+	},
+}
+
+// TrafficProfile shapes the visits of a bot like the traffic of a real site,
+// the rate of the visits at a time is VisitsPerHour times the intensity of
+// its hour of the day times the intensity of its day of the week.
+type TrafficProfile struct {
+	// Preset fills the intensities not given, flat if empty
+	Preset string `json:"preset,omitempty"`
+	// Timezone the hours and days are read in, UTC if empty
+	Timezone string `json:"timezone,omitempty"`
+	// VisitsPerHour is the rate of the visits at an intensity of 1
+	VisitsPerHour float64 `json:"visitsPerHour"`
+	// HourlyIntensity has the 24 intensities of the hours of the day, from midnight
+	HourlyIntensity []float64 `json:"hourlyIntensity,omitempty"`
+	// DailyIntensity has the 7 intensities of the days of the week, from sunday
+	DailyIntensity []float64 `json:"dailyIntensity,omitempty"`
+}
+
+// Validate checks the profile and fills its intensities from its preset
+func (profile *TrafficProfile) Validate() error {
+	if profile.Preset == "" {
+		profile.Preset = FLATTRAFFIC
+	}
+	preset, ok := trafficPresets[profile.Preset]
+	if !ok {
+		return fmt.Errorf("Unknown traffic preset %q, should be flat, business-hours or retail-24-7", profile.Preset)
+	}
+	if _, err := time.LoadLocation(profile.Timezone); err != nil {
+		return fmt.Errorf("Unknown traffic timezone %q", profile.Timezone)
+	}
+	if profile.VisitsPerHour == 0 {
+		profile.VisitsPerHour = DEFAULTVISITSPERHOUR
+	}
+	if profile.VisitsPerHour < 0 || profile.VisitsPerHour > MAXIMUMVISITSPERHOUR {
+		return fmt.Errorf("Traffic visitsPerHour should be in ]0,%v]", MAXIMUMVISITSPERHOUR)
+	}
+	if profile.HourlyIntensity == nil {
+		profile.HourlyIntensity = append([]float64{}, preset.hourly...)
+	}
+	if profile.DailyIntensity == nil {
+		profile.DailyIntensity = append([]float64{}, preset.daily...)
+	}
+	if len(profile.HourlyIntensity) != 24 {
+		return errors.New("Traffic hourlyIntensity should have 24 values, from midnight")
+	}
+	if len(profile.DailyIntensity) != 7 {
+		return errors.New("Traffic dailyIntensity should have 7 values, from sunday")
+	}
+	if !validIntensities(profile.HourlyIntensity) || !validIntensities(profile.DailyIntensity) {
+		return errors.New("Traffic intensities should be positive, with at least one hour and one day above 0")
+	}
+	return nil
+}
+
+func validIntensities(intensities []float64) bool {
+	visits := false
+	for _, intensity := range intensities {
+		if intensity < 0 {
+			return false
+		}
+		visits = visits || intensity > 0
+	}
+	return visits
+}
+
+func (profile *TrafficProfile) location() *time.Location {
+	location, err := time.LoadLocation(profile.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// VisitsPerHourAt returns the rate of the visits at the given time
+func (profile *TrafficProfile) VisitsPerHourAt(t time.Time) float64 {
+	local := t.In(profile.location())
+	return profile.VisitsPerHour * profile.HourlyIntensity[local.Hour()] * profile.DailyIntensity[local.Weekday()]
+}
+
+// TrafficPacer spaces the visits of a bot following its traffic profile, the
+// visits arrive at random like the visitors of a real site.
+type TrafficPacer struct {
+	profile *TrafficProfile
+	random  *rand.Rand
+	last    time.Time
+}
+
+// NewTrafficPacer paces the visits of a validated profile starting at the given time
+func NewTrafficPacer(profile *TrafficProfile, random *rand.Rand, start time.Time) *TrafficPacer {
+	return &TrafficPacer{profile: profile, random: random, last: start}
+}
+
+// Next returns the time of the next visit, a bot behind the profile visits
+// right away but does not catch up on the visits it missed.
+func (pacer *TrafficPacer) Next(now time.Time) time.Time {
+	t := pacer.last
+	location := pacer.profile.location()
+	// the rate is the same for a whole hour, and the time to the next visit
+	// is drawn again at every change since the arrivals have no memory
+	for {
+		local := t.In(location)
+		hour := time.Date(local.Year(), local.Month(), local.Day(), local.Hour()+1, 0, 0, 0, location)
+		rate := pacer.profile.VisitsPerHourAt(t)
+		if rate > 0 {
+			next := t.Add(time.Duration(pacer.random.ExpFloat64() / rate * float64(time.Hour)))
+			if next.Before(hour) {
+				t = next
+				break
+			}
+		}
+		t = hour
+	}
+	if t.Before(now) {
+		t = now
+	}
+	pacer.last = t
+	return t
+}
@@ -15,9 +15,15 @@ func CountWordOccurence(words []string) WordCounts {
 			word_occurence[word] = 1
 		}
 	}
+	// sorted so that the words are always picked in the same order from a seed
+	keys := make([]string, 0, len(word_occurence))
+	for key := range word_occurence {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 	wordCounts := WordCounts{}
-	for key, value := range word_occurence {
-		wordCounts.Words = append(wordCounts.Words, WordCount{Word: key, Count: value})
+	for _, key := range keys {
+		wordCounts.Words = append(wordCounts.Words, WordCount{Word: key, Count: word_occurence[key]})
 	}
 	return wordCounts
 }
@@ -0,0 +1,217 @@
+package explorerlib
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrVocabularyNotFound = errors.New("Vocabulary not found")
+
+// TENANTSDIRECTORY holds a directory of vocabularies for each tenant
+const TENANTSDIRECTORY string = "tenants"
+
+// VocabularyKey identifies the exploration a vocabulary was discovered with
+type VocabularyKey struct {
+	SearchEndpoint   string   `json:"searchEndpoint"`
+	Org              string   `json:"org"`
+	Fields           []string `json:"fields"`
+	ExplorationRatio float64  `json:"explorationRatio"`
+}
+
+func NewVocabularyKey(config *Config) VocabularyKey {
+	fields := append([]string{}, config.FieldsToExploreEqually...)
+	sort.Strings(fields)
+	return VocabularyKey{
+		SearchEndpoint:   config.SearchEndpoint,
+		Org:              config.Org,
+		Fields:           fields,
+		ExplorationRatio: config.DocumentsExplorationPercentage,
+	}
+}
+
+// Id is a hash of the key, used to name the vocabulary on disk and in the API
+func (key VocabularyKey) Id() string {
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s|%v", key.SearchEndpoint, key.Org, strings.Join(key.Fields, ","), key.ExplorationRatio)))
+	return hex.EncodeToString(hash[:])
+}
+
+// Vocabulary is the result of an exploration, the words found in each language
+type Vocabulary struct {
+	Key                  VocabularyKey         `json:"key"`
+	CreationTime         time.Time             `json:"creationTime"`
+	WordCountsByLanguage map[string]WordCounts `json:"wordCountsByLanguage"`
+}
+
+type VocabularySummary struct {
+	Id                      string         `json:"id"`
+	Key                     VocabularyKey  `json:"key"`
+	CreationTime            time.Time      `json:"creationTime"`
+	Expired                 bool           `json:"expired"`
+	NumberOfWordsByLanguage map[string]int `json:"numberOfWordsByLanguage"`
+}
+
+// VocabularyCache keeps the vocabularies on disk so that a bot exploring an
+// index already explored recently can skip the exploration.
+type VocabularyCache struct {
+	directory string
+	maxAge    time.Duration
+	mutex     sync.Mutex
+	// tenants holds the cache of every tenant, so the bots of a tenant share its lock
+	tenants map[string]*VocabularyCache
+}
+
+func NewVocabularyCache(directory string, maxAge time.Duration) (*VocabularyCache, error) {
+	err := os.MkdirAll(directory, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &VocabularyCache{
+		directory: directory,
+		maxAge:    maxAge,
+		tenants:   make(map[string]*VocabularyCache),
+	}, nil
+}
+
+// ForTenant returns a cache holding only the vocabularies of a tenant, a nil
+// cache stays nil and the empty tenant shares the whole cache.
+func (cache *VocabularyCache) ForTenant(tenant string) (*VocabularyCache, error) {
+	if cache == nil || tenant == "" {
+		return cache, nil
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	tenantCache, ok := cache.tenants[tenant]
+	if ok {
+		return tenantCache, nil
+	}
+	tenantCache, err := NewVocabularyCache(filepath.Join(cache.directory, TENANTSDIRECTORY, filepath.Base(tenant)), cache.maxAge)
+	if err != nil {
+		return nil, err
+	}
+	cache.tenants[tenant] = tenantCache
+	return tenantCache, nil
+}
+
+func (cache *VocabularyCache) path(id string) string {
+	return filepath.Join(cache.directory, id+".json")
+}
+
+func (cache *VocabularyCache) isExpired(vocabulary *Vocabulary) bool {
+	return time.Since(vocabulary.CreationTime) > cache.maxAge
+}
+
+// Get returns the vocabulary for the key, ok is false if there is none or if it is too old
+func (cache *VocabularyCache) Get(key VocabularyKey) (vocabulary *Vocabulary, ok bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	vocabulary, err := cache.read(cache.path(key.Id()))
+	if err != nil || cache.isExpired(vocabulary) {
+		return nil, false
+	}
+	return vocabulary, true
+}
+
+func (cache *VocabularyCache) read(path string) (*Vocabulary, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrVocabularyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	vocabulary := &Vocabulary{}
+	err = json.Unmarshal(bytes, vocabulary)
+	return vocabulary, err
+}
+
+func (cache *VocabularyCache) Save(key VocabularyKey, wordCountsByLanguage map[string]WordCounts) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	bytes, err := json.Marshal(Vocabulary{
+		Key:                  key,
+		CreationTime:         time.Now(),
+		WordCountsByLanguage: wordCountsByLanguage,
+	})
+	if err != nil {
+		return err
+	}
+	// a temporary file of its own, another server may share the directory
+	temporary, err := ioutil.TempFile(cache.directory, key.Id()+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = temporary.Write(bytes)
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temporary.Name())
+		return err
+	}
+	return os.Rename(temporary.Name(), cache.path(key.Id()))
+}
+
+func (cache *VocabularyCache) List() ([]VocabularySummary, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	files, err := ioutil.ReadDir(cache.directory)
+	if err != nil {
+		return nil, err
+	}
+	summaries := []VocabularySummary{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		vocabulary, err := cache.read(filepath.Join(cache.directory, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		numberOfWordsByLanguage := make(map[string]int)
+		for language, wordCounts := range vocabulary.WordCountsByLanguage {
+			numberOfWordsByLanguage[language] = len(wordCounts.Words)
+		}
+		summaries = append(summaries, VocabularySummary{
+			Id:                      vocabulary.Key.Id(),
+			Key:                     vocabulary.Key,
+			CreationTime:            vocabulary.CreationTime,
+			Expired:                 cache.isExpired(vocabulary),
+			NumberOfWordsByLanguage: numberOfWordsByLanguage,
+		})
+	}
+	return summaries, nil
+}
+
+func (cache *VocabularyCache) Delete(id string) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	err := os.Remove(cache.path(filepath.Base(id)))
+	if os.IsNotExist(err) {
+		return ErrVocabularyNotFound
+	}
+	return err
+}
+
+func (cache *VocabularyCache) DeleteAll() error {
+	summaries, err := cache.List()
+	if err != nil {
+		return err
+	}
+	for _, summary := range summaries {
+		err = cache.Delete(summary.Id)
+		if err != nil && err != ErrVocabularyNotFound {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,19 +1,15 @@
 package explorerlib
 
 import (
+	"errors"
 	"fmt"
 	"github.com/jmcvetta/randutil"
 	"math"
 	"math/rand"
 	"strings"
-	"time"
 )
 
-var (
-	s1        = rand.NewSource(time.Now().UnixNano())
-	random    = rand.New(s1)
-	stopwords *Stopwords
-)
+var stopwords *Stopwords
 
 type WordCount struct {
 	Word  string
@@ -87,23 +83,24 @@ func (firstPairList WordCounts) Extend(secondPairList WordCounts) WordCounts {
 	return mergedPairList
 }
 
-func (wordCounts WordCounts) PickRandomWord() string {
+// PickRandomWord picks a word with the random of the job, so that a seed gives the same words
+func (wordCounts WordCounts) PickRandomWord(random *rand.Rand) string {
 	if size := len(wordCounts.Words); size != 0 {
 		return wordCounts.Words[random.Intn(size)].Word
 	}
 	return ""
 }
 
-func (wordCounts WordCounts) PickExpNWords(n int) string {
-	numberOfWords := randomNumberWithExpMinMax(1, math.MaxInt64, float64(n))
+func (wordCounts WordCounts) PickExpNWords(random *rand.Rand, n int) string {
+	numberOfWords := randomNumberWithExpMinMax(random, 1, math.MaxInt64, float64(n))
 	words := make([]string, 0)
 	for i := 0; i < numberOfWords; i++ {
-		words = append(words, wordCounts.PickRandomWord())
+		words = append(words, wordCounts.PickRandomWord(random))
 	}
 	return strings.Join(words, " ")
 }
 
-func randomNumberWithExpMinMax(min int, max int, lambda float64) int {
+func randomNumberWithExpMinMax(random *rand.Rand, min int, max int, lambda float64) int {
 	var exponentialrandomint = math.MaxInt64
 	for min > exponentialrandomint || exponentialrandomint >= max {
 		exponentialrandomint = int(random.ExpFloat64()*lambda + 0.5)
@@ -111,22 +108,42 @@ func randomNumberWithExpMinMax(min int, max int, lambda float64) int {
 	return exponentialrandomint
 }
 
-func (wordCounts WordCounts) PickRandomWordWeighted(choices []randutil.Choice) string {
-	result, err := randutil.WeightedChoice(choices)
+func (wordCounts WordCounts) PickRandomWordWeighted(random *rand.Rand, choices []randutil.Choice) string {
+	result, err := weightedChoice(random, choices)
 	if err != nil {
 		return ""
 	}
 	return fmt.Sprintf("%v", result.Item)
 }
 
-func (wordCounts WordCounts) PickExpNWordsWeighted(choices []randutil.Choice, n int) string {
-	numberOfWords := randomNumberWithExpMinMax(1, math.MaxInt64, float64(n))
+func (wordCounts WordCounts) PickExpNWordsWeighted(random *rand.Rand, choices []randutil.Choice, n int) string {
+	numberOfWords := randomNumberWithExpMinMax(random, 1, math.MaxInt64, float64(n))
 	words := make([]string, 0)
 	for i := 0; i < numberOfWords; i++ {
-		word := wordCounts.PickRandomWordWeighted(choices)
+		word := wordCounts.PickRandomWordWeighted(random, choices)
 		if !contains(words, word) {
 			words = append(words, word)
 		}
 	}
 	return strings.Join(words, " ")
 }
+
+// weightedChoice picks a choice with a probability proportional to its weight,
+// randutil.WeightedChoice cannot be seeded.
+func weightedChoice(random *rand.Rand, choices []randutil.Choice) (randutil.Choice, error) {
+	sum := 0
+	for _, choice := range choices {
+		sum += choice.Weight
+	}
+	if sum <= 0 {
+		return randutil.Choice{}, errors.New("No choice with a positive weight")
+	}
+	picked := random.Intn(sum)
+	for _, choice := range choices {
+		picked -= choice.Weight
+		if picked < 0 {
+			return choice, nil
+		}
+	}
+	return choices[len(choices)-1], nil
+}
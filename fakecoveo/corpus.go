@@ -0,0 +1,62 @@
+package fakecoveo
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Document is a document of the fake index, its fields are matched by the
+// @field="value" expressions of the queries.
+type Document struct {
+	Title  string            `json:"title"`
+	URI    string            `json:"uri"`
+	Fields map[string]string `json:"fields"`
+}
+
+var wordsByLanguage = map[string][]string{
+	"English": {
+		"account", "billing", "browser", "cache", "cluster", "connector", "dashboard", "database",
+		"deploy", "error", "export", "firewall", "install", "invoice", "license", "login",
+		"network", "password", "permission", "printer", "proxy", "query", "report", "security",
+		"server", "storage", "support", "update", "upgrade", "user", "wireless", "workflow",
+	},
+	"French": {
+		"compte", "facture", "navigateur", "grappe", "connecteur", "tableau", "donnees", "erreur",
+		"exporter", "pare-feu", "installer", "licence", "connexion", "reseau", "motdepasse", "imprimante",
+		"requete", "rapport", "securite", "serveur", "stockage", "soutien", "mise", "utilisateur",
+	},
+}
+
+var sources = []string{"Documentation", "Forum", "Knowledge Base"}
+
+// NewCorpus generates the documents of the fake index, the same seed always
+// gives the same documents.
+func NewCorpus(seed int64, numberOfDocuments int) []Document {
+	random := rand.New(rand.NewSource(seed))
+	languages := []string{"English", "French"}
+	documents := make([]Document, 0, numberOfDocuments)
+	for i := 0; i < numberOfDocuments; i++ {
+		language := languages[random.Intn(len(languages))]
+		words := wordsByLanguage[language]
+		titleWords := make([]string, 3+random.Intn(4))
+		for j := range titleWords {
+			titleWords[j] = words[random.Intn(len(words))]
+		}
+		uri := fmt.Sprintf("https://fake.coveo.local/documents/%v", i)
+		hash := sha1.Sum([]byte(uri))
+		documents = append(documents, Document{
+			Title: strings.Join(titleWords, " "),
+			URI:   uri,
+			Fields: map[string]string{
+				"@syslanguage": language,
+				"@language":    language,
+				"@syssource":   sources[random.Intn(len(sources))],
+				"@sysurihash":  hex.EncodeToString(hash[:8]),
+			},
+		})
+	}
+	return documents
+}
@@ -0,0 +1,247 @@
+// Package fakecoveo is a fake of the Coveo search and usage analytics APIs
+// answering from a generated corpus and recording the events it receives,
+// so that bots can run end to end without any network.
+package fakecoveo
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coveo/go-coveo/search"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	// SEARCHPATH is where the search API is served, the search endpoint of a bot is the server URL followed by it
+	SEARCHPATH string = "/rest/search/"
+	// ANALYTICSPATH is where the analytics API is served
+	ANALYTICSPATH string = "/rest/v15/analytics/"
+	// EVENTSPATH lists the analytics events recorded
+	EVENTSPATH string = "/fake/events"
+
+	DEFAULTNUMBEROFRESULTS int = 10
+)
+
+// Event is an analytics event received by the fake
+type Event struct {
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Body map[string]interface{} `json:"body"`
+}
+
+type Server struct {
+	documents []Document
+	events    []Event
+	queries   []search.Query
+	mutex     sync.Mutex
+}
+
+func NewServer(documents []Document) *Server {
+	return &Server{documents: documents}
+}
+
+// Handler serves the search API under SEARCHPATH and the analytics API under ANALYTICSPATH
+func (server *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(SEARCHPATH, server.serveSearch)
+	mux.HandleFunc(ANALYTICSPATH, server.serveAnalytics)
+	mux.HandleFunc(EVENTSPATH, func(writter http.ResponseWriter, request *http.Request) {
+		writter.Header().Add("Content-Type", "application/json")
+		json.NewEncoder(writter).Encode(server.Events())
+	})
+	return mux
+}
+
+// Events returns the analytics events received, oldest first
+func (server *Server) Events() []Event {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]Event{}, server.events...)
+}
+
+// EventCounts returns the number of analytics events received by type
+func (server *Server) EventCounts() map[string]int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	counts := make(map[string]int)
+	for _, event := range server.events {
+		counts[event.Type]++
+	}
+	return counts
+}
+
+// Queries returns the search queries received, oldest first
+func (server *Server) Queries() []search.Query {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]search.Query{}, server.queries...)
+}
+
+// Reset forgets the events and queries received
+func (server *Server) Reset() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.events = nil
+	server.queries = nil
+}
+
+func authorized(writter http.ResponseWriter, request *http.Request) bool {
+	if !strings.HasPrefix(request.Header.Get("Authorization"), "Bearer ") {
+		http.Error(writter, "Missing token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (server *Server) serveSearch(writter http.ResponseWriter, request *http.Request) {
+	if !authorized(writter, request) {
+		return
+	}
+	writter.Header().Add("Content-Type", "application/json")
+	if strings.HasSuffix(request.URL.Path, "/values") {
+		maximumNumberOfValues, _ := strconv.Atoi(request.URL.Query().Get("maximumNumberOfValues"))
+		json.NewEncoder(writter).Encode(server.facetValues(request.URL.Query().Get("field"), maximumNumberOfValues))
+		return
+	}
+	query := search.Query{}
+	if request.Method == "POST" {
+		err := json.NewDecoder(request.Body).Decode(&query)
+		if err != nil {
+			http.Error(writter, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		query.Q = request.URL.Query().Get("q")
+		query.AQ = request.URL.Query().Get("aq")
+		query.NumberOfResults, _ = strconv.Atoi(request.URL.Query().Get("numberOfResults"))
+	}
+	server.mutex.Lock()
+	server.queries = append(server.queries, query)
+	server.mutex.Unlock()
+	json.NewEncoder(writter).Encode(server.search(query))
+}
+
+func (server *Server) serveAnalytics(writter http.ResponseWriter, request *http.Request) {
+	if !authorized(writter, request) {
+		return
+	}
+	if request.Method != "POST" {
+		http.Error(writter, "Only events can be sent", http.StatusMethodNotAllowed)
+		return
+	}
+	eventType := strings.Trim(strings.TrimPrefix(request.URL.Path, ANALYTICSPATH), "/")
+	switch eventType {
+	case "search", "click", "view", "custom":
+	default:
+		http.NotFound(writter, request)
+		return
+	}
+	body := map[string]interface{}{}
+	err := json.NewDecoder(request.Body).Decode(&body)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	server.mutex.Lock()
+	server.events = append(server.events, Event{Type: eventType, Time: time.Now(), Body: body})
+	server.mutex.Unlock()
+	writter.Header().Add("Content-Type", "application/json")
+	writter.Write([]byte("{}"))
+}
+
+var fieldExpression = regexp.MustCompile(`(@\w+)\s*==?\s*"([^"]*)"`)
+
+// matcher keeps the documents whose fields have the values of the
+// @field="value" expressions and whose title has all the other words.
+type matcher struct {
+	fields map[string]string
+	words  []string
+}
+
+func newMatcher(query search.Query) matcher {
+	expression := query.Q + " " + query.AQ + " " + query.CQ
+	fields := make(map[string]string)
+	for _, match := range fieldExpression.FindAllStringSubmatch(expression, -1) {
+		fields[strings.ToLower(match[1])] = match[2]
+	}
+	words := strings.Fields(strings.ToLower(fieldExpression.ReplaceAllString(expression, " ")))
+	return matcher{fields: fields, words: words}
+}
+
+func (matcher matcher) matches(document Document) bool {
+	for field, value := range matcher.fields {
+		if !strings.EqualFold(document.Fields[field], value) {
+			return false
+		}
+	}
+	title := strings.ToLower(document.Title)
+	for _, word := range matcher.words {
+		if !strings.Contains(title, word) {
+			return false
+		}
+	}
+	return true
+}
+
+func (server *Server) search(query search.Query) *search.Response {
+	matcher := newMatcher(query)
+	numberOfResults := query.NumberOfResults
+	if numberOfResults <= 0 {
+		numberOfResults = DEFAULTNUMBEROFRESULTS
+	}
+	response := &search.Response{
+		SearchUID: uuid.NewV4().String(),
+		Results:   []search.Result{},
+	}
+	for _, document := range server.documents {
+		if !matcher.matches(document) {
+			continue
+		}
+		response.TotalCount++
+		if response.TotalCount <= query.FirstResult || len(response.Results) >= numberOfResults {
+			continue
+		}
+		raw := map[string]interface{}{}
+		for field, value := range document.Fields {
+			raw[strings.TrimPrefix(field, "@")] = value
+		}
+		response.Results = append(response.Results, search.Result{
+			Title:    document.Title,
+			URI:      document.URI,
+			ClickURI: document.URI,
+			Raw:      raw,
+		})
+	}
+	response.TotalCountFiltered = response.TotalCount
+	return response
+}
+
+func (server *Server) facetValues(field string, maximumNumberOfValues int) *search.FacetValues {
+	counts := make(map[string]int)
+	for _, document := range server.documents {
+		if value, ok := document.Fields[strings.ToLower(field)]; ok {
+			counts[value]++
+		}
+	}
+	values := &search.FacetValues{Values: []search.FacetValue{}}
+	for value, count := range counts {
+		values.Values = append(values.Values, search.FacetValue{Value: value, LookupValue: value, NumberOfResults: count})
+	}
+	// the ties are broken on the value so the fake always answers the same
+	sort.Slice(values.Values, func(i, j int) bool {
+		if values.Values[i].NumberOfResults != values.Values[j].NumberOfResults {
+			return values.Values[i].NumberOfResults > values.Values[j].NumberOfResults
+		}
+		return values.Values[i].Value < values.Values[j].Value
+	})
+	if maximumNumberOfValues > 0 && len(values.Values) > maximumNumberOfValues {
+		values.Values = values.Values[:maximumNumberOfValues]
+	}
+	return values
+}
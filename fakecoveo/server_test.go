@@ -0,0 +1,26 @@
+package fakecoveo
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFacetValuesBreakTiesOnTheValue(t *testing.T) {
+	documents := []Document{}
+	for i := 0; i < 20; i++ {
+		documents = append(documents, Document{Fields: map[string]string{"@syssource": fmt.Sprintf("source %02d", i)}})
+	}
+	documents = append(documents, Document{Fields: map[string]string{"@syssource": "source 19"}})
+	server := NewServer(documents)
+	for i := 0; i < 10; i++ {
+		values := server.facetValues("@syssource", 0).Values
+		if values[0].Value != "source 19" || values[0].NumberOfResults != 2 {
+			t.Fatalf("first value %+v, want the most frequent", values[0])
+		}
+		for j, value := range values[1:] {
+			if want := fmt.Sprintf("source %02d", j); value.Value != want {
+				t.Fatalf("value %v is %v, want %v", j+1, value.Value, want)
+			}
+		}
+	}
+}
@@ -38,6 +38,8 @@ type Visit struct {
 	Anonymous          bool
 	Language           string
 	WaitBetweenActions bool
+	random             *rand.Rand
+	uatoken            string
 }
 
 const (
@@ -49,14 +51,52 @@ const (
 	ORIGINALL string = "ALL"
 )
 
+// EventSent is called after every analytics event is sent, with the
+// analytics token and the org of the visit and the type of the event (search,
+// click, view or custom), when it is set.
+var EventSent func(uatoken string, org string, eventType string, err error)
+
+func (v *Visit) eventSent(eventType string, err error) {
+	if EventSent != nil {
+		EventSent(v.uatoken, v.Config.OrgName, eventType, err)
+	}
+}
+
+// NewAnalyticsClient creates the client sending the analytics events of a
+// visit, it is replaced to send the events somewhere else.
+var NewAnalyticsClient = ua.NewClient
+
+// VisitRandom returns the random of the bot the analytics token was handed
+// to, so that the visits of a seeded bot are the same on every run. The
+// visits use a random of their own when it is not set or returns nil.
+var VisitRandom func(uatoken string) *rand.Rand
+
+// WaitForVisit blocks until the bot the analytics token was handed to is due
+// for its next visit, when it is set.
+var WaitForVisit func(uatoken string)
+
+func visitRandom(uatoken string) *rand.Rand {
+	if VisitRandom != nil {
+		if random := VisitRandom(uatoken); random != nil {
+			return random
+		}
+	}
+	return rand.New(rand.NewSource(rand.Int63()))
+}
+
 // NewVisit     Creates a new visit to the search page
 // _searchtoken The token used to be able to search
 // _uatoken     The token used to send usage analytics events
 // _useragent   The user agent the analytics events will see
 func NewVisit(_searchtoken string, _uatoken string, _useragent string, language string, c *Config) (*Visit, error) {
+	if WaitForVisit != nil {
+		WaitForVisit(_uatoken)
+	}
 
 	v := Visit{}
 	v.Config = c
+	v.random = visitRandom(_uatoken)
+	v.uatoken = _uatoken
 
 	v.WaitBetweenActions = !c.DontWaitBetweenVisits
 	v.Anonymous = false
@@ -67,13 +107,13 @@ func NewVisit(_searchtoken string, _uatoken string, _useragent string, language
 		} else {
 			threshold = DEFAULTANONYMOUSTHRESHOLD
 		}
-		if rand.Float64() <= threshold {
+		if v.random.Float64() <= threshold {
 			v.Anonymous = true
 			Info.Printf("Anonymous visit")
 		}
 	}
 	if !v.Anonymous {
-		v.Username = buildUserEmail(c)
+		v.Username = buildUserEmail(v.random, c)
 		Info.Printf("New visit from %s", v.Username)
 	}
 	//Info.Printf("On device %s", _useragent)
@@ -81,7 +121,7 @@ func NewVisit(_searchtoken string, _uatoken string, _useragent string, language
 		v.Language = language
 	} else {
 		if len(v.Config.Languages) > 0 {
-			v.Language = v.Config.Languages[rand.Intn(len(v.Config.Languages))]
+			v.Language = v.Config.Languages[v.random.Intn(len(v.Config.Languages))]
 		} else {
 			v.Language = "en"
 		}
@@ -97,10 +137,10 @@ func NewVisit(_searchtoken string, _uatoken string, _useragent string, language
 	v.SearchClient = searchClient
 
 	// Create the http UAClient
-	ip := c.RandomIPs[rand.Intn(len(c.RandomIPs))]
+	ip := c.RandomIPs[v.random.Intn(len(c.RandomIPs))]
 	v.IP = ip
 	uaConfig := ua.Config{Token: _uatoken, UserAgent: _useragent, IP: ip, Endpoint: c.AnalyticsEndpoint}
-	uaClient, err := ua.NewClient(uaConfig)
+	uaClient, err := NewAnalyticsClient(uaConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -109,8 +149,8 @@ func NewVisit(_searchtoken string, _uatoken string, _useragent string, language
 	return &v, nil
 }
 
-func buildUserEmail(c *Config) string {
-	return fmt.Sprint(c.FirstNames[rand.Intn(len(c.FirstNames))], ".", c.LastNames[rand.Intn(len(c.LastNames))], c.Emails[rand.Intn(len(c.Emails))])
+func buildUserEmail(random *rand.Rand, c *Config) string {
+	return fmt.Sprint(c.FirstNames[random.Intn(len(c.FirstNames))], ".", c.LastNames[random.Intn(len(c.LastNames))], c.Emails[random.Intn(len(c.Emails))])
 }
 
 // ExecuteScenario Execute a specific scenario, send the config for all the
@@ -179,13 +219,13 @@ func (v *Visit) sendSearchEvent(q, actionCause, actionType string, customData ma
 	}
 
 	if v.Config.AllowEntitlements { // Custom shit for besttech, I don't like it
-		event.CustomData["entitlement"] = generateEntitlementBesttech(v.Anonymous)
+		event.CustomData["entitlement"] = generateEntitlementBesttech(v.random, v.Anonymous)
 	}
 
 	// Send all the possible random custom data that can be added from the config
 	// scenario file.
 	for _, elem := range v.Config.RandomCustomData {
-		event.CustomData[elem.APIName] = elem.Values[rand.Intn(len(elem.Values))]
+		event.CustomData[elem.APIName] = elem.Values[v.random.Intn(len(elem.Values))]
 	}
 
 	// Override possible values of customData with the specific customData sent
@@ -204,8 +244,9 @@ func (v *Visit) sendSearchEvent(q, actionCause, actionType string, customData ma
 	}
 
 	// Send a UA search event
-	error := v.UAClient.SendSearchEvent(event)
-	if error != nil {
+	err = v.UAClient.SendSearchEvent(event)
+	v.eventSent("search", err)
+	if err != nil {
 		return err
 	}
 	return nil
@@ -237,6 +278,7 @@ func (v *Visit) sendViewEvent(rank int, contentType string) error {
 
 	// Send a UA view event
 	err = v.UAClient.SendViewEvent(event)
+	v.eventSent("view", err)
 	if err != nil {
 		return err
 	}
@@ -272,13 +314,13 @@ func (v *Visit) sendCustomEvent(actionCause, actionType string, customData map[s
 	}
 
 	if v.Config.AllowEntitlements { // Custom shit for besttech, I don't like it
-		event.CustomData["entitlement"] = generateEntitlementBesttech(v.Anonymous)
+		event.CustomData["entitlement"] = generateEntitlementBesttech(v.random, v.Anonymous)
 	}
 
 	// Send all the possible random custom data that can be added from the config
 	// scenario file.
 	for _, elem := range v.Config.RandomCustomData {
-		event.CustomData[elem.APIName] = elem.Values[rand.Intn(len(elem.Values))]
+		event.CustomData[elem.APIName] = elem.Values[v.random.Intn(len(elem.Values))]
 	}
 
 	// Override possible values of customData with the specific customData sent
@@ -288,6 +330,7 @@ func (v *Visit) sendCustomEvent(actionCause, actionType string, customData map[s
 
 	// Send a UA search event
 	err = v.UAClient.SendCustomEvent(event)
+	v.eventSent("custom", err)
 	return err
 }
 
@@ -341,7 +384,7 @@ func (v *Visit) sendClickEvent(rank int, quickview bool, customData map[string]i
 	}
 
 	if v.Config.AllowEntitlements { // Custom shit for besttech, I don't like it
-		event.CustomData["entitlement"] = generateEntitlementBesttech(v.Anonymous)
+		event.CustomData["entitlement"] = generateEntitlementBesttech(v.random, v.Anonymous)
 	}
 
 	event.CustomData["author"] = generateRandomAuthor(event.DocumentTitle)
@@ -349,7 +392,7 @@ func (v *Visit) sendClickEvent(rank int, quickview bool, customData map[string]i
 	// Send all the possible random custom data that can be added from the config
 	// scenario file.
 	for _, elem := range v.Config.RandomCustomData {
-		event.CustomData[elem.APIName] = elem.Values[rand.Intn(len(elem.Values))]
+		event.CustomData[elem.APIName] = elem.Values[v.random.Intn(len(elem.Values))]
 	}
 
 	// Override possible values of customData with the specific customData sent
@@ -358,6 +401,7 @@ func (v *Visit) sendClickEvent(rank int, quickview bool, customData map[string]i
 	}
 
 	err = v.UAClient.SendClickEvent(event)
+	v.eventSent("click", err)
 	if err != nil {
 		return err
 	}
@@ -403,13 +447,13 @@ func (v *Visit) sendInterfaceChangeEvent(actionCause, actionType string, customD
 	}
 
 	if v.Config.AllowEntitlements { // Custom shit for besttech, I don't like it
-		event.CustomData["entitlement"] = generateEntitlementBesttech(v.Anonymous)
+		event.CustomData["entitlement"] = generateEntitlementBesttech(v.random, v.Anonymous)
 	}
 
 	// Send all the possible random custom data that can be added from the config
 	// scenario file.
 	for _, elem := range v.Config.RandomCustomData {
-		event.CustomData[elem.APIName] = elem.Values[rand.Intn(len(elem.Values))]
+		event.CustomData[elem.APIName] = elem.Values[v.random.Intn(len(elem.Values))]
 	}
 
 	// Override possible values of customData with the specific customData sent
@@ -418,6 +462,7 @@ func (v *Visit) sendInterfaceChangeEvent(actionCause, actionType string, customD
 	}
 
 	err = v.UAClient.SendSearchEvent(event)
+	v.eventSent("search", err)
 	if err != nil {
 		return err
 	}
@@ -462,11 +507,11 @@ func generateRandomAuthor(title string) string {
 	return defaults.AUTHORNAMES[(int)(math.Mod((float64)(hash(title)), (float64)(len(defaults.AUTHORNAMES))))]
 }
 
-func generateEntitlementBesttech(isAnonymous bool) string {
+func generateEntitlementBesttech(random *rand.Rand, isAnonymous bool) string {
 	if isAnonymous {
 		return "Anonymous"
 	}
-	if rand.Float64() <= 0.1 {
+	if random.Float64() <= 0.1 {
 		return "Premier"
 	}
 	return "Basic"
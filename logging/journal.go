@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"container/list"
+	"sync"
+)
+
+const (
+	DEFAULTJOBLOGLENGTH int = 1000
+	// DEFAULTJOBLOGS is the number of jobs whose entries are kept
+	DEFAULTJOBLOGS int = 200
+)
+
+// ring keeps the last entries logged for a job, it grows as entries are
+// logged until it holds length entries
+type ring struct {
+	job     string
+	entries []Entry
+	// next is the oldest entry once the ring is full
+	next int
+}
+
+func (ring *ring) append(entry Entry, length int) {
+	if len(ring.entries) < length {
+		ring.entries = append(ring.entries, entry)
+		return
+	}
+	ring.entries[ring.next] = entry
+	ring.next = (ring.next + 1) % len(ring.entries)
+}
+
+// last returns at most n entries, from the oldest to the newest
+func (ring *ring) last(n int) []Entry {
+	entries := append(append([]Entry{}, ring.entries[ring.next:]...), ring.entries[:ring.next]...)
+	if n > 0 && n < len(entries) {
+		entries = entries[len(entries)-n:]
+	}
+	return entries
+}
+
+// jobJournal keeps the rings of the jobs used last, the ring of the job used
+// least recently is dropped when there are too many
+type jobJournal struct {
+	mutex   sync.Mutex
+	length  int
+	maximum int
+	rings   map[string]*list.Element
+	// used holds the rings from the most to the least recently used
+	used *list.List
+}
+
+var journal = &jobJournal{
+	length:  DEFAULTJOBLOGLENGTH,
+	maximum: DEFAULTJOBLOGS,
+	rings:   make(map[string]*list.Element),
+	used:    list.New(),
+}
+
+// SetJobLogLength sets how many entries are kept for each job
+func SetJobLogLength(length int) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	journal.length = length
+}
+
+// SetJobLogs sets how many jobs have their entries kept, the entries of the
+// job used least recently are dropped first
+func SetJobLogs(maximum int) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	journal.maximum = maximum
+	journal.evict()
+}
+
+func (journal *jobJournal) evict() {
+	for journal.used.Len() > 0 && journal.used.Len() > journal.maximum {
+		oldest := journal.used.Back()
+		journal.used.Remove(oldest)
+		delete(journal.rings, oldest.Value.(*ring).job)
+	}
+}
+
+func (journal *jobJournal) append(entry Entry) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	if journal.length <= 0 || journal.maximum <= 0 {
+		return
+	}
+	element, ok := journal.rings[entry.Job]
+	if ok {
+		journal.used.MoveToFront(element)
+	} else {
+		element = journal.used.PushFront(&ring{job: entry.Job})
+		journal.rings[entry.Job] = element
+		journal.evict()
+	}
+	element.Value.(*ring).append(entry, journal.length)
+}
+
+// Tail returns the last n entries of a job, all the entries kept if n is 0
+func Tail(job string, n int) []Entry {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	element, ok := journal.rings[job]
+	if !ok {
+		return []Entry{}
+	}
+	journal.used.MoveToFront(element)
+	return element.Value.(*ring).last(n)
+}
+
+// Forget drops the entries of a job
+func Forget(job string) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	element, ok := journal.rings[job]
+	if !ok {
+		return
+	}
+	journal.used.Remove(element)
+	delete(journal.rings, job)
+}
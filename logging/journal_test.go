@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"fmt"
+	"testing"
+)
+
+func logTo(job string, messages ...string) {
+	for _, message := range messages {
+		journal.append(Entry{Job: job, Message: message})
+	}
+}
+
+func messages(entries []Entry) []string {
+	messages := []string{}
+	for _, entry := range entries {
+		messages = append(messages, entry.Message)
+	}
+	return messages
+}
+
+func TestTailKeepsTheLastEntriesInOrder(t *testing.T) {
+	SetJobLogLength(3)
+	defer SetJobLogLength(DEFAULTJOBLOGLENGTH)
+	defer Forget("ring")
+
+	logTo("ring", "1", "2")
+	if got := fmt.Sprint(messages(Tail("ring", 0))); got != "[1 2]" {
+		t.Errorf("Tail before the ring is full = %v, want [1 2]", got)
+	}
+	logTo("ring", "3", "4", "5")
+	if got := fmt.Sprint(messages(Tail("ring", 0))); got != "[3 4 5]" {
+		t.Errorf("Tail once the ring wrapped = %v, want [3 4 5]", got)
+	}
+	if got := fmt.Sprint(messages(Tail("ring", 2))); got != "[4 5]" {
+		t.Errorf("Tail of 2 = %v, want [4 5]", got)
+	}
+}
+
+func TestRingsGrowAsEntriesAreLogged(t *testing.T) {
+	defer Forget("small")
+	logTo("small", "1")
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+	if capacity := cap(journal.rings["small"].Value.(*ring).entries); capacity >= DEFAULTJOBLOGLENGTH {
+		t.Errorf("a ring with one entry has a capacity of %v", capacity)
+	}
+}
+
+func TestTheJobUsedLeastRecentlyIsDropped(t *testing.T) {
+	SetJobLogs(2)
+	defer SetJobLogs(DEFAULTJOBLOGS)
+	defer Forget("a")
+	defer Forget("b")
+	defer Forget("c")
+
+	logTo("a", "a")
+	logTo("b", "b")
+	Tail("a", 0)
+	logTo("c", "c")
+	if entries := Tail("b", 0); len(entries) != 0 {
+		t.Errorf("job b should be dropped, it has %v", messages(entries))
+	}
+	for _, job := range []string{"a", "c"} {
+		if entries := Tail(job, 0); len(entries) != 1 {
+			t.Errorf("job %v should be kept, it has %v", job, messages(entries))
+		}
+	}
+}
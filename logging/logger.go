@@ -0,0 +1,207 @@
+// Package logging writes log entries tagged with the job, org, phase and
+// routine they come from, as text or JSON, and keeps the last entries of
+// every job to serve them from the API.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level string
+
+const (
+	INFO    Level = "info"
+	WARNING Level = "warning"
+	ERROR   Level = "error"
+)
+
+const (
+	TEXTFORMAT string = "text"
+	JSONFORMAT string = "json"
+)
+
+// Entry is a line of log
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Level    Level     `json:"level"`
+	Message  string    `json:"message"`
+	Job      string    `json:"job,omitempty"`
+	Schedule string    `json:"schedule,omitempty"`
+	Org      string    `json:"org,omitempty"`
+	Phase    string    `json:"phase,omitempty"`
+	Routine  *int      `json:"routine,omitempty"`
+}
+
+type output struct {
+	mutex   sync.Mutex
+	format  string
+	writers map[Level]io.Writer
+}
+
+var out = &output{
+	format: TEXTFORMAT,
+	writers: map[Level]io.Writer{
+		INFO:    os.Stdout,
+		WARNING: os.Stdout,
+		ERROR:   os.Stderr,
+	},
+}
+
+// Configure sets the format of the entries and where each level is written,
+// use ioutil.Discard to drop a level.
+func Configure(format string, info io.Writer, warning io.Writer, err io.Writer) error {
+	if format != TEXTFORMAT && format != JSONFORMAT {
+		return fmt.Errorf("Unknown log format %q, should be text or json", format)
+	}
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	out.format = format
+	out.writers = map[Level]io.Writer{
+		INFO:    info,
+		WARNING: warning,
+		ERROR:   err,
+	}
+	return nil
+}
+
+// Format returns the format set with Configure
+func Format() string {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+	return out.format
+}
+
+func (output *output) write(entry Entry) {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+	writer := output.writers[entry.Level]
+	if output.format == JSONFORMAT {
+		bytes, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		writer.Write(append(bytes, '\n'))
+		return
+	}
+	fmt.Fprintln(writer, entry.String())
+}
+
+func (entry Entry) String() string {
+	tags := []string{}
+	if entry.Job != "" {
+		tags = append(tags, "job="+entry.Job)
+	}
+	if entry.Schedule != "" {
+		tags = append(tags, "schedule="+entry.Schedule)
+	}
+	if entry.Org != "" {
+		tags = append(tags, "org="+entry.Org)
+	}
+	if entry.Phase != "" {
+		tags = append(tags, "phase="+entry.Phase)
+	}
+	if entry.Routine != nil {
+		tags = append(tags, fmt.Sprintf("routine=%v", *entry.Routine))
+	}
+	prefix := strings.ToUpper(string(entry.Level)) + ": " + entry.Time.Format("2006/01/02 15:04:05")
+	if len(tags) > 0 {
+		prefix += " [" + strings.Join(tags, " ") + "]"
+	}
+	return prefix + " " + entry.Message
+}
+
+// Logger tags its entries with the fields it was created with, a nil Logger
+// writes entries without any field.
+type Logger struct {
+	job      string
+	schedule string
+	org      string
+	phase    string
+	routine  *int
+}
+
+// ForJob returns a logger tagging the entries with a job and its org, the
+// entries are also kept to be listed with Tail.
+func ForJob(job string, org string) *Logger {
+	return &Logger{job: job, org: org}
+}
+
+// ForSchedule returns a logger tagging the entries with a schedule and the org of its jobs
+func ForSchedule(schedule string, org string) *Logger {
+	return &Logger{schedule: schedule, org: org}
+}
+
+func (logger *Logger) copy() *Logger {
+	if logger == nil {
+		return &Logger{}
+	}
+	copy := *logger
+	return &copy
+}
+
+func (logger *Logger) WithPhase(phase string) *Logger {
+	copy := logger.copy()
+	copy.phase = phase
+	return copy
+}
+
+func (logger *Logger) WithRoutine(routine int) *Logger {
+	copy := logger.copy()
+	copy.routine = &routine
+	return copy
+}
+
+func (logger *Logger) log(level Level, format string, arguments ...interface{}) {
+	entry := Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Message: strings.TrimRight(fmt.Sprintf(format, arguments...), "\n"),
+	}
+	if logger != nil {
+		entry.Job = logger.job
+		entry.Schedule = logger.schedule
+		entry.Org = logger.org
+		entry.Phase = logger.phase
+		entry.Routine = logger.routine
+	}
+	out.write(entry)
+	if entry.Job != "" {
+		journal.append(entry)
+	}
+}
+
+func (logger *Logger) Infof(format string, arguments ...interface{}) {
+	logger.log(INFO, format, arguments...)
+}
+
+func (logger *Logger) Warningf(format string, arguments ...interface{}) {
+	logger.log(WARNING, format, arguments...)
+}
+
+func (logger *Logger) Errorf(format string, arguments ...interface{}) {
+	logger.log(ERROR, format, arguments...)
+}
+
+// lineWriter logs every line written to it, it lets the loggers of
+// scenariolib use the format of the structured logs.
+type lineWriter struct {
+	level Level
+}
+
+// Writer returns a writer logging each line written as an entry of the level
+func Writer(level Level) io.Writer {
+	return lineWriter{level: level}
+}
+
+func (writer lineWriter) Write(bytes []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(bytes), "\n"), "\n") {
+		(*Logger)(nil).log(writer.level, "%s", line)
+	}
+	return len(bytes), nil
+}
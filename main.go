@@ -1,24 +1,55 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"github.com/coveo/uabot-server/autobot"
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/coveo/uabot-server/fakecoveo"
+	"github.com/coveo/uabot-server/logging"
 	"github.com/coveo/uabot-server/server"
 	"github.com/coveo/uabot/scenariolib"
+	"github.com/satori/go.uuid"
+	"io"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 	"time"
 )
 
 var (
-	queueLength    = flag.Int("queue-length", 100, "Length of the queue of workers")
-	port           = flag.String("port", "8080", "Server port")
-	routinesPerCPU = flag.Int("routinesPerCPU", 2, "Maximum number of routine per CPU")
-	silent         = flag.Bool("silent", false, "dump the Info prints")
+	queueLength           = flag.Int("queue-length", 100, "Length of the queue of workers")
+	port                  = flag.String("port", "8080", "Server port")
+	routinesPerCPU        = flag.Int("routinesPerCPU", 2, "Maximum number of routine per CPU")
+	routinesPerTenant     = flag.Int("routines-per-tenant", 0, "Maximum number of routines running the bots of a tenant, 0 for no limit")
+	routinesByTenant      = flag.String("tenant-routines", "", "Maximum number of routines of the tenants that do not use the default, as tenant1=2,tenant2=5")
+	routinesPerOrg        = flag.Int("routines-per-org", 0, "Maximum number of routines running the bots of an org, 0 for no limit")
+	routinesByOrg         = flag.String("org-routines", "", "Maximum number of routines of the orgs that do not use the default, as org1=2,org2=5")
+	silent                = flag.Bool("silent", false, "dump the Info prints")
+	logFormat             = flag.String("log-format", "text", "Format of the logs, text or json")
+	jobLogLength          = flag.Int("job-log-length", logging.DEFAULTJOBLOGLENGTH, "Number of lines kept for each job and returned by GET /jobs/{id}/logs")
+	jobLogs               = flag.Int("job-logs", logging.DEFAULTJOBLOGS, "Number of jobs whose lines are kept, the lines of the job used least recently are dropped first")
+	jobsDirectory         = flag.String("jobs-dir", "jobs", "Directory where jobs are saved to survive a restart, empty to keep them in memory only")
+	jobsKeyPath           = flag.String("jobs-key", "", "File holding the hex encoded AES-256 key used to encrypt the saved jobs and schedules, they are saved in plain JSON if empty")
+	configsDirectory      = flag.String("configs-dir", "configs", "Directory where the uabot configurations generated by the jobs are written")
+	eventsDirectory       = flag.String("events-dir", "events", "Directory where the jobs with a file sink write their events")
+	archivesDirectory     = flag.String("search-archives-dir", "search-archives", "Directory where the jobs record and replay their search archives")
+	schedulesDirectory    = flag.String("schedules-dir", "schedules", "Directory where the schedules are saved, empty to keep them in memory only")
+	vocabulariesDirectory = flag.String("vocabularies-dir", "vocabularies", "Directory where the words found by exploring an index are cached, empty to disable the cache")
+	vocabularyMaxAge      = flag.Duration("vocabulary-max-age", 24*time.Hour, "Maximum age of a cached vocabulary before the index is explored again")
+	queriesPerSecond      = flag.Float64("queries-per-second", explorerlib.DEFAULTQUERIESPERSECOND, "Queries per second sent to the index of an org by all its bots, 0 for no limit")
+	queriesPerSecondByOrg = flag.String("org-queries-per-second", "", "Queries per second of the orgs that do not use the default, as org1=10,org2=2.5")
+	searchTimeout         = flag.Duration("search-timeout", explorerlib.DEFAULTSEARCHTIMEOUT, "Timeout of a query sent to an index, 0 for none")
+	searchRetries         = flag.Int("search-retries", explorerlib.DEFAULTSEARCHRETRIES, "Number of times a query failing with a network error, a 429 or a 5xx is sent again")
+	searchBackoff         = flag.Duration("search-backoff", explorerlib.DEFAULTSEARCHBACKOFF, "Wait before the first retry of a query, doubled at every retry")
+	searchMaxBackoff      = flag.Duration("search-max-backoff", explorerlib.DEFAULTSEARCHMAXBACKOFF, "Longest wait between two retries of a query")
+	apiKeysPath           = flag.String("api-keys", "", "JSON file mapping every tenant to its API keys, anyone can use the API if empty")
+	shutdownGracePeriod   = flag.Duration("shutdown-grace-period", 30*time.Second, "Time given to the running bots to stop when the server receives SIGTERM or SIGINT")
 )
 
 const (
@@ -32,16 +63,17 @@ const (
 )
 
 func main() {
-	flag.Parse()
-
-	if *silent {
-		scenariolib.InitLogger(ioutil.Discard, ioutil.Discard, os.Stdout, os.Stderr)
-	} else {
-		scenariolib.InitLogger(ioutil.Discard, os.Stdout, os.Stdout, os.Stderr)
+	if len(os.Args) > 1 && os.Args[1] == "plan" {
+		plan(os.Args[2:])
+		return
 	}
+	if len(os.Args) > 1 && os.Args[1] == "fake" {
+		fake(os.Args[2:])
+		return
+	}
+	flag.Parse()
 
-	source := rand.NewSource(int64(time.Now().Unix()))
-	random := rand.New(source)
+	initLoggers()
 
 	if *queueLength < MINIMUMQUEUELENGTH || *queueLength > MAXIMUMQUEUELENGTH {
 		scenariolib.Info.Printf("Queue Length is out of bounds, should be in [%v,%v], will use default value of %v ", MINIMUMQUEUELENGTH, MAXIMUMQUEUELENGTH, DEFAULTQUEUELENGTH)
@@ -59,9 +91,233 @@ func main() {
 
 	concurrentGoRoutine := *routinesPerCPU * runtime.NumCPU()
 	scenariolib.Info.Printf("Number of workers: %v", concurrentGoRoutine)
-	workPool := server.NewWorkPool(concurrentGoRoutine, int32(*queueLength))
+	caps := server.ConcurrencyCaps{Tenant: *routinesPerTenant, Org: *routinesPerOrg}
+	var err error
+	caps.ByTenant, err = server.ParseConcurrencyCaps(*routinesByTenant)
+	if err != nil {
+		log.Fatal(err)
+	}
+	caps.ByOrg, err = server.ParseConcurrencyCaps(*routinesByOrg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scenariolib.Info.Printf("Routines by tenant: %v, %v for the others", caps.ByTenant, caps.Tenant)
+	scenariolib.Info.Printf("Routines by org: %v, %v for the others", caps.ByOrg, caps.Org)
+	workPool := server.NewWorkPool(concurrentGoRoutine, int32(*queueLength), caps)
+
+	var key []byte
+	if *jobsKeyPath != "" {
+		var err error
+		key, err = server.LoadEncryptionKey(*jobsKeyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scenariolib.Info.Printf("Jobs and schedules are encrypted with the key in %v", *jobsKeyPath)
+	}
+
+	var jobStore server.JobStore
+	if *jobsDirectory == "" {
+		jobStore = server.NewMemoryJobStore()
+	} else {
+		var err error
+		jobStore, err = server.NewFileJobStore(*jobsDirectory, key)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	scenariolib.Info.Printf("Jobs directory: %v", *jobsDirectory)
+
+	var scheduleStore server.ScheduleStore
+	if *schedulesDirectory == "" {
+		scheduleStore = server.NewMemoryScheduleStore()
+	} else {
+		var err error
+		scheduleStore, err = server.NewFileScheduleStore(*schedulesDirectory, key)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	scenariolib.Info.Printf("Schedules directory: %v", *schedulesDirectory)
+
+	var vocabularies *explorerlib.VocabularyCache
+	if *vocabulariesDirectory != "" {
+		var err error
+		vocabularies, err = explorerlib.NewVocabularyCache(*vocabulariesDirectory, *vocabularyMaxAge)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scenariolib.Info.Printf("Vocabularies directory: %v, max age: %v", *vocabulariesDirectory, *vocabularyMaxAge)
+	}
+
+	directories := server.Directories{Configs: *configsDirectory, Events: *eventsDirectory, SearchArchives: *archivesDirectory}
+	err = directories.Create()
+	if err != nil {
+		log.Fatal(err)
+	}
+	scenariolib.Info.Printf("Configurations directory: %v, events directory: %v, search archives directory: %v", directories.Configs, directories.Events, directories.SearchArchives)
+
+	var apiKeys server.ApiKeys
+	if *apiKeysPath != "" {
+		var err error
+		apiKeys, err = server.LoadApiKeys(*apiKeysPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scenariolib.Info.Printf("Loaded %v API keys", len(apiKeys))
+	}
+
+	ratesByOrg, err := explorerlib.ParseQueriesPerSecondByOrg(*queriesPerSecondByOrg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scenariolib.Info.Printf("Queries per second by org: %v, %v for the others", ratesByOrg, *queriesPerSecond)
+	rateLimiters := explorerlib.NewRateLimiters(*queriesPerSecond, ratesByOrg)
+
+	retryPolicy := explorerlib.RetryPolicy{
+		Timeout:    *searchTimeout,
+		Retries:    *searchRetries,
+		Backoff:    *searchBackoff,
+		MaxBackoff: *searchMaxBackoff,
+	}
+	scenariolib.Info.Printf("Search timeout: %v, retries: %v, backoff: %v to %v", retryPolicy.Timeout, retryPolicy.Retries, retryPolicy.Backoff, retryPolicy.MaxBackoff)
+
+	server.Init(workPool, jobStore, scheduleStore, vocabularies, directories, apiKeys, rateLimiters, retryPolicy)
+	err = server.RestoreJobs()
+	if err != nil {
+		scenariolib.Error.Printf("Cannot restore jobs : %v", err)
+	}
+	err = server.StartScheduler()
+	if err != nil {
+		log.Fatal(err)
+	}
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%v", *port),
+		Handler: server.NewRouter(),
+	}
+	go func() {
+		err := httpServer.ListenAndServeTLS("server.crt", "server.key")
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
 
-	server.Init(workPool, random)
-	router := server.NewRouter()
-	log.Fatal(http.ListenAndServeTLS(fmt.Sprintf(":%v", *port), "server.crt", "server.key", router))
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	received := <-signals
+	scenariolib.Info.Printf("Received %v, shutting down", received)
+	shutdown(httpServer)
+}
+
+// shutdown stops the bots first, they are saved to be resumed on the next
+// boot, then waits for the pending requests within the same grace period.
+func shutdown(httpServer *http.Server) {
+	deadline := time.Now().Add(*shutdownGracePeriod)
+	if !server.Shutdown(*shutdownGracePeriod) {
+		scenariolib.Warning.Printf("Some bots did not stop in time, they will be resumed on the next boot")
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	err := httpServer.Shutdown(ctx)
+	if err != nil {
+		scenariolib.Error.Printf("Cannot shut down the server cleanly : %v", err)
+	}
+}
+
+// fake serves a fake of the search and analytics APIs, to run bots without
+// reaching Coveo.
+func fake(arguments []string) {
+	fakeFlags := flag.NewFlagSet("fake", flag.ExitOnError)
+	fakePort := fakeFlags.String("port", "9000", "Port of the fake Coveo server")
+	seed := fakeFlags.Int64("seed", 1, "Seed of the generated documents")
+	numberOfDocuments := fakeFlags.Int("documents", 1000, "Number of documents in the fake index")
+	fakeFlags.Parse(arguments)
+
+	fakeServer := fakecoveo.NewServer(fakecoveo.NewCorpus(*seed, *numberOfDocuments))
+	address := fmt.Sprintf("localhost:%v", *fakePort)
+	fmt.Printf("searchEndpoint: http://%v%v\n", address, fakecoveo.SEARCHPATH)
+	fmt.Printf("analyticsEndpoint: http://%v%v\n", address, fakecoveo.ANALYTICSPATH)
+	fmt.Printf("events received: http://%v%v\n", address, fakecoveo.EVENTSPATH)
+	log.Fatal(http.ListenAndServe(address, fakeServer.Handler()))
+}
+
+// initLoggers sets the format of the logs, in JSON the lines logged by
+// scenariolib are turned into entries without job.
+func initLoggers() {
+	var info io.Writer = os.Stdout
+	if *silent {
+		info = ioutil.Discard
+	}
+	err := logging.Configure(*logFormat, info, os.Stdout, os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logging.SetJobLogLength(*jobLogLength)
+	logging.SetJobLogs(*jobLogs)
+	if *logFormat != logging.JSONFORMAT {
+		scenariolib.InitLogger(ioutil.Discard, info, os.Stdout, os.Stderr)
+		return
+	}
+	if *silent {
+		scenariolib.InitLogger(ioutil.Discard, ioutil.Discard, logging.Writer(logging.WARNING), logging.Writer(logging.ERROR))
+	} else {
+		scenariolib.InitLogger(ioutil.Discard, logging.Writer(logging.INFO), logging.Writer(logging.WARNING), logging.Writer(logging.ERROR))
+	}
+	for _, logger := range []*log.Logger{scenariolib.Info, scenariolib.Warning, scenariolib.Error} {
+		logger.SetPrefix("")
+		logger.SetFlags(0)
+	}
+}
+
+// plan explores an index and writes the uabot configuration without sending
+// any analytics, the configuration is a start request like the one posted to /start.
+func plan(arguments []string) {
+	planFlags := flag.NewFlagSet("plan", flag.ExitOnError)
+	configPath := planFlags.String("config", "", "Path of the JSON start request, read from stdin if empty")
+	outputPath := planFlags.String("output", "", "Path of the generated uabot configuration, overrides outputFilePath")
+	recordPath := planFlags.String("record", "", "Path of an archive where the search requests and responses are recorded")
+	replayPath := planFlags.String("replay", "", "Path of an archive the search responses are replayed from, instead of querying the index")
+	planFlags.Parse(arguments)
+
+	scenariolib.InitLogger(ioutil.Discard, os.Stderr, os.Stderr, os.Stderr)
+	logging.Configure(logging.TEXTFORMAT, os.Stderr, os.Stderr, os.Stderr)
+	logging.SetJobLogLength(0)
+
+	reader := os.Stdin
+	if *configPath != "" {
+		file, err := os.Open(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		reader = file
+	}
+	config, err := server.DecodeConfig(reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.Id = uuid.NewV4()
+	config.PlanOnly = true
+	if *outputPath != "" {
+		config.OutputFilePath = *outputPath
+	}
+	if *recordPath != "" {
+		config.SearchArchiveMode = explorerlib.RECORDARCHIVE
+		config.SearchArchivePath = *recordPath
+	}
+	if *replayPath != "" {
+		config.SearchArchiveMode = explorerlib.REPLAYARCHIVE
+		config.SearchArchivePath = *replayPath
+	}
+	err = server.ValidateLocalConfig(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bot := autobot.NewAutobot(config)
+	bot.UseRateLimiters(explorerlib.NewRateLimiters(explorerlib.DEFAULTQUERIESPERSECOND, nil))
+	err = bot.Plan(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(config.OutputFilePath)
 }
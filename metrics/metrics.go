@@ -0,0 +1,82 @@
+// Package metrics holds the Prometheus collectors shared by the bots, the
+// explorer and the server, they are exposed on /metrics.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const NAMESPACE string = "uabot"
+
+// Kinds of search requests
+const (
+	QUERYREQUEST string = "query"
+	FACETREQUEST string = "facet"
+)
+
+// Causes of the errors counted
+const (
+	SEARCHERROR    string = "search"
+	ANALYTICSERROR string = "analytics"
+	EXPLORERROR    string = "exploration"
+	JOBERROR       string = "job"
+)
+
+var (
+	SearchRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "search_requests_total",
+		Help:      "Search requests sent to the index, by org and kind of request.",
+	}, []string{"org", "kind"})
+
+	SearchRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "search_request_duration_seconds",
+		Help:      "Duration of the search requests sent to the index, by org and kind of request.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"org", "kind"})
+
+	AnalyticsEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "analytics_events_total",
+		Help:      "Analytics events sent, by org and type of event.",
+	}, []string{"org", "type"})
+
+	Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "errors_total",
+		Help:      "Errors by cause.",
+	}, []string{"cause"})
+
+	ExplorationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "exploration_duration_seconds",
+		Help:      "Time taken to explore an index, by org.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"org"})
+)
+
+func init() {
+	prometheus.MustRegister(SearchRequests, SearchRequestDuration, AnalyticsEvents, Errors, ExplorationDuration)
+}
+
+// ObserveSearchRequest counts a search request started at the given time
+func ObserveSearchRequest(org string, kind string, start time.Time, err error) {
+	SearchRequests.WithLabelValues(org, kind).Inc()
+	SearchRequestDuration.WithLabelValues(org, kind).Observe(time.Since(start).Seconds())
+	if err != nil {
+		Errors.WithLabelValues(SEARCHERROR).Inc()
+	}
+}
+
+// ObserveAnalyticsEvent counts an analytics event, it is called by the
+// scenariolib.EventSent hook
+func ObserveAnalyticsEvent(org string, eventType string, err error) {
+	if err != nil {
+		Errors.WithLabelValues(ANALYTICSERROR).Inc()
+		return
+	}
+	AnalyticsEvents.WithLabelValues(org, eventType).Inc()
+}
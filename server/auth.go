@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type contextKey string
+
+const tenantContextKey contextKey = "tenant"
+
+// ApiKeys maps every API key to the tenant using it
+type ApiKeys map[string]string
+
+// LoadApiKeys reads a JSON file listing the API keys of every tenant :
+// {"tenant" : ["key1", "key2"]}
+func LoadApiKeys(path string) (ApiKeys, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keysByTenant := map[string][]string{}
+	err = json.Unmarshal(bytes, &keysByTenant)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys := ApiKeys{}
+	for tenant, keys := range keysByTenant {
+		if tenant == "" {
+			return nil, errors.New("Tenant name Missing in API keys")
+		}
+		for _, key := range keys {
+			if key == "" {
+				return nil, errors.New("Empty API key for tenant: " + tenant)
+			}
+			if other, ok := apiKeys[key]; ok && other != tenant {
+				return nil, errors.New("API key shared by tenants " + other + " and " + tenant)
+			}
+			apiKeys[key] = tenant
+		}
+	}
+	return apiKeys, nil
+}
+
+func apiKeyFromRequest(request *http.Request) string {
+	if key := request.Header.Get("X-Api-Key"); key != "" {
+		return key
+	}
+	authorization := request.Header.Get("Authorization")
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimPrefix(authorization, "Bearer ")
+	}
+	return ""
+}
+
+// authenticate rejects the requests without a known API key and remembers
+// the tenant of the others. Every request is let through when no API keys
+// are configured.
+func authenticate(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writter http.ResponseWriter, request *http.Request) {
+		if apiKeys == nil {
+			handler.ServeHTTP(writter, request)
+			return
+		}
+		tenant, ok := apiKeys[apiKeyFromRequest(request)]
+		if !ok {
+			writter.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(writter, "Invalid or missing API key", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(writter, request.WithContext(context.WithValue(request.Context(), tenantContextKey, tenant)))
+	})
+}
+
+// tenantFromRequest returns the tenant who sent the request, empty when authentication is disabled
+func tenantFromRequest(request *http.Request) string {
+	tenant, _ := request.Context().Value(tenantContextKey).(string)
+	return tenant
+}
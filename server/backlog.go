@@ -0,0 +1,116 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"github.com/coveo/uabot-server/logging"
+	"github.com/coveo/uabot/scenariolib"
+	"github.com/satori/go.uuid"
+)
+
+// backloggedJob orders a job of the backlog without reading it from the store
+type backloggedJob struct {
+	id        uuid.UUID
+	priority  int
+	startTime time.Time
+}
+
+// backlog holds the jobs waiting in the backlog, the highest priority then the
+// oldest first, protected by jobsMutex
+var backlog []backloggedJob
+
+// enterBacklog adds the job to the backlog in the order it is drained, the
+// caller must hold jobsMutex
+func enterBacklog(job *Job) {
+	entry := backloggedJob{id: job.Config.Id, priority: job.Config.Priority, startTime: job.StartTime}
+	i := sort.Search(len(backlog), func(i int) bool {
+		if backlog[i].priority != entry.priority {
+			return backlog[i].priority < entry.priority
+		}
+		return backlog[i].startTime.After(entry.startTime)
+	})
+	backlog = append(backlog, backloggedJob{})
+	copy(backlog[i+1:], backlog[i:])
+	backlog[i] = entry
+}
+
+// leaveBacklog takes the job out of the backlog if it is in it, the caller
+// must hold jobsMutex
+func leaveBacklog(id uuid.UUID) {
+	for i, entry := range backlog {
+		if entry.id == id {
+			backlog = append(backlog[:i], backlog[i+1:]...)
+			return
+		}
+	}
+}
+
+// admit saves the job and posts it to the work pool. When the queue is full
+// the job is parked in the backlog if wait is true, and forgotten otherwise.
+func admit(job *Job, wait bool) error {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	return admitLocked(job, wait)
+}
+
+func admitLocked(job *Job, wait bool) error {
+	err := scheduleLocked(job)
+	if err != ErrQueueFull {
+		return err
+	}
+	if !wait {
+		deleteErr := jobStore.Delete(job.Config.Id)
+		if deleteErr != nil {
+			jobLogger(job).Warningf("Cannot forget the job rejected by the full queue : %v", deleteErr)
+		}
+		events.forget(job.Config.Id)
+		logging.Forget(job.Config.Id.String())
+		return err
+	}
+	jobLogger(job).Infof("Queue is full, job waits in the backlog")
+	job.PausedTimeToLive = job.RemainingTimeToLive()
+	job.SetState(JOBBACKLOGGED)
+	err = saveJob(job)
+	if err != nil {
+		return err
+	}
+	enterBacklog(job)
+	return nil
+}
+
+// drainBacklog posts the backlogged jobs to the work pool while its queue has
+// room, the highest priority first then the oldest. It is called every time a
+// queued job leaves the queue.
+func drainBacklog() {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	for len(backlog) > 0 && !draining && workPool.QueuedWork() < workPool.QueueLength {
+		// the queue only grows under jobsMutex, the room found here stays
+		id := backlog[0].id
+		backlog = backlog[1:]
+		job, err := jobStore.Get(id)
+		if err != nil {
+			scenariolib.Error.Printf("Cannot read the backlogged job %v : %v", id, err)
+			continue
+		}
+		if job.State != JOBBACKLOGGED {
+			continue
+		}
+		job.Deadline = time.Now().Add(job.PausedTimeToLive)
+		job.PausedTimeToLive = 0
+		job.SetState(JOBQUEUED)
+		err = scheduleLocked(job)
+		if err != nil {
+			jobLogger(job).Errorf("Cannot post the backlogged job : %v", err)
+			job.Error = err.Error()
+			job.SetState(JOBFAILED)
+			err = saveJob(job)
+			if err != nil {
+				jobLogger(job).Errorf("Cannot save the failed job : %v", err)
+			}
+			continue
+		}
+		jobLogger(job).Infof("Job left the backlog with %v left to live", job.RemainingTimeToLive())
+	}
+}
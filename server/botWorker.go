@@ -3,36 +3,86 @@ package server
 import (
 	"github.com/coveo/uabot-server/autobot"
 	"github.com/coveo/uabot-server/explorerlib"
-	"github.com/coveo/uabot/scenariolib"
+	"github.com/coveo/uabot-server/logging"
 	"github.com/satori/go.uuid"
-	"math/rand"
 )
 
 type BotWorker struct {
 	Worker
-	bot     *autobot.Autobot
-	id      uuid.UUID
-	channel chan bool
+	bot    *autobot.Autobot
+	id     uuid.UUID
+	tenant string
+	signal *quitSignal
+	logger *logging.Logger
 }
 
 type Worker interface {
 	DoWork(goRoutine int)
 }
 
+var phaseStates = map[autobot.Phase]JobState{
+	autobot.EXPLORING:       JOBEXPLORING,
+	autobot.BUILDINGQUERIES: JOBBUILDINGQUERIES,
+	autobot.RUNNING:         JOBRUNNING,
+}
+
 func (worker BotWorker) DoWork(goRoutine int) {
-	scenariolib.Info.Printf("Bot starting on worker: %v\n", goRoutine)
-	err := worker.bot.Run(worker.channel)
+	if !startWork(worker.id, worker.signal) {
+		worker.logger.Infof("Job was stopped before starting")
+		return
+	}
+	defer runningBots.Done()
+	logger := worker.logger.WithRoutine(goRoutine)
+	logger.Infof("Bot starting on worker: %v", goRoutine)
+	worker.bot.UseLogger(logger)
+	worker.bot.OnPhaseChange(func(phase autobot.Phase) {
+		setJobState(worker.id, phaseStates[phase])
+	})
+	worker.bot.OnQueryReport(func(reports []explorerlib.LanguageQueryReport) {
+		updateJob(worker.id, func(job *Job) bool {
+			job.QueryReports = reports
+			return true
+		})
+	})
+	worker.bot.OnTargetCounts(func(counts explorerlib.TargetCounts) {
+		updateJob(worker.id, func(job *Job) bool {
+			job.TargetCounts = &counts
+			return true
+		})
+	})
+	worker.bot.ReportProgressTo(events.newProgress(worker.id))
+	err := worker.bot.Run(worker.signal.context)
+	if worker.signal.isClosed() {
+		// the bot was stopped, the error only tells it was interrupted
+		err = nil
+	}
 	if err != nil {
-		scenariolib.Error.Println(err)
+		logger.Errorf("%v", err)
 	}
+	endWork(worker.id, worker.signal, err)
 }
 
-func NewWorker(config *explorerlib.Config, quitChannel chan bool, random *rand.Rand, id uuid.UUID) Worker {
+func NewWorker(job *Job, signal *quitSignal) Worker {
+	bot := autobot.NewAutobot(serverConfig(job))
+	bot.UseRateLimiters(rateLimiters)
+	bot.UseRetryPolicy(retryPolicy)
+	if job.TargetCounts != nil {
+		bot.ResumeTarget(*job.TargetCounts)
+	}
+	logger := jobLogger(job)
+	tenantVocabularies, err := vocabularies.ForTenant(job.Tenant)
+	if err != nil {
+		logger.Warningf("Cannot use the vocabularies of tenant %v : %v", job.Tenant, err)
+	} else {
+		bot.UseVocabularyCache(tenantVocabularies)
+	}
 	return Worker(WorkWrapper{
 		realWorker: &BotWorker{
-			bot:     autobot.NewAutobot(config, random),
-			id:      id,
-			channel: quitChannel,
+			bot:    bot,
+			id:     job.Config.Id,
+			tenant: job.Tenant,
+			signal: signal,
+			logger: logger,
 		},
 		workPool: workPool,
 	})
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/satori/go.uuid"
+)
+
+// Directories hold the files the jobs write and read on the server, the paths
+// given by the clients are kept inside them so that a job cannot reach the
+// other files of the server.
+type Directories struct {
+	// Configs holds the uabot configurations generated by the jobs, named after the job
+	Configs string
+	// Events holds the files the jobs with a file sink append their events to
+	Events string
+	// SearchArchives holds the archives the searches are recorded to and replayed from
+	SearchArchives string
+}
+
+// Create creates the directories that do not exist yet
+func (directories Directories) Create() error {
+	for _, directory := range []string{directories.Configs, directories.Events, directories.SearchArchives} {
+		if directory == "" {
+			continue
+		}
+		err := os.MkdirAll(directory, 0700)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configPath is where the uabot configuration of a job is generated
+func configPath(id uuid.UUID) string {
+	return filepath.Join(directories.Configs, id.String()+".json")
+}
+
+// tenantPath returns the path given by a tenant inside its own directory in
+// directory, the .. leaving it are dropped.
+func tenantPath(directory string, tenant string, path string) string {
+	if tenant != "" {
+		directory = filepath.Join(directory, explorerlib.TENANTSDIRECTORY, filepath.Base(tenant))
+	}
+	return filepath.Join(directory, filepath.Clean(string(filepath.Separator)+path))
+}
+
+// serverConfig returns a copy of the configuration of the job with its files
+// in the directories of the server
+func serverConfig(job *Job) *explorerlib.Config {
+	config := *job.Config
+	config.OutputFilePath = configPath(config.Id)
+	if config.EventsFilePath != "" {
+		config.EventsFilePath = tenantPath(directories.Events, job.Tenant, config.EventsFilePath)
+	}
+	if config.SearchArchivePath != "" {
+		config.SearchArchivePath = tenantPath(directories.SearchArchives, job.Tenant, config.SearchArchivePath)
+	}
+	return &config
+}
+
+// validateRelativePath checks that a path given by a client cannot leave the
+// directory of the server it is resolved in
+func validateRelativePath(name string, path string) error {
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "/") {
+		return fmt.Errorf("%v %q should be a relative path", name, path)
+	}
+	for _, element := range strings.Split(filepath.ToSlash(path), "/") {
+		if element == ".." {
+			return fmt.Errorf("%v %q should not contain ..", name, path)
+		}
+	}
+	return nil
+}
@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/coveo/uabot-server/autobot"
+	"github.com/coveo/uabot-server/eventsink"
 	"github.com/coveo/uabot-server/explorerlib"
 	"github.com/coveo/uabot/scenariolib"
 	"github.com/gorilla/mux"
 	"github.com/satori/go.uuid"
-	"math/rand"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -17,6 +20,8 @@ const (
 	MINIMUMTIMETOLIVE int = 1
 	MAXIMUMTIMETOLIVE int = 120
 	DEFAULTIMETOLIVE  int = 2
+	// MAXIMUMBUDGETTIMETOLIVE lets a job with a budget target spread it over a whole day
+	MAXIMUMBUDGETTIMETOLIVE int = 1440
 
 	MINIMUMNUMBERWORDSPERQUERY int = 1
 	MAXIMUMNUMBERWORDSPERQUERY int = 20
@@ -33,18 +38,48 @@ const (
 	MINIMUMFETCHNUMBEROFRESULTS int = 1
 	MAXIMUMFETCHNUMBEROFRESULTS int = 1000
 	DEFAULTFETCHNUMBEROFRESULTS int = 100
+
+	// the attempts to find the queries of a language default to this many per query
+	DEFAULTQUERYATTEMPTSPERQUERY     int = 10
+	DEFAULTMINIMUMQUERIESPERLANGUAGE int = 1
+
+	MINIMUMPRIORITY int = -10
+	MAXIMUMPRIORITY int = 10
+	DEFAULTPRIORITY int = 0
 )
 
 var (
-	quitChannels map[uuid.UUID]chan bool
-	random       *rand.Rand
+	quitChannels map[uuid.UUID]*quitSignal
 	workPool     *WorkPool
+	jobStore     JobStore
+	schedules    ScheduleStore
+	vocabularies *explorerlib.VocabularyCache
+	directories  Directories
+	apiKeys      ApiKeys
+	rateLimiters *explorerlib.RateLimiters
+	retryPolicy  explorerlib.RetryPolicy
 )
 
-func Init(_workPool *WorkPool, _random *rand.Rand) {
+// Init sets up the server, _vocabularies can be nil to always explore the index,
+// _apiKeys nil to let anyone use the API and _rateLimiters nil to query the
+// indexes as fast as they answer. The queries failing are retried following
+// _retryPolicy. The files of the jobs are kept in _directories.
+func Init(_workPool *WorkPool, _jobStore JobStore, _schedules ScheduleStore, _vocabularies *explorerlib.VocabularyCache, _directories Directories, _apiKeys ApiKeys, _rateLimiters *explorerlib.RateLimiters, _retryPolicy explorerlib.RetryPolicy) {
 	workPool = _workPool
-	quitChannels = make(map[uuid.UUID]chan bool)
-	random = _random
+	quitChannels = make(map[uuid.UUID]*quitSignal)
+	jobStore = _jobStore
+	schedules = _schedules
+	vocabularies = _vocabularies
+	directories = _directories
+	apiKeys = _apiKeys
+	rateLimiters = _rateLimiters
+	retryPolicy = _retryPolicy
+	registerMetrics()
+	// the visits of the jobs writing to a sink find it by their analytics token
+	scenariolib.NewAnalyticsClient = eventsink.Wrap(scenariolib.NewAnalyticsClient)
+	scenariolib.VisitRandom = autobot.VisitRandom
+	scenariolib.WaitForVisit = autobot.WaitForVisit
+	workPool.OnRoom(drainBacklog)
 }
 
 func Start(writter http.ResponseWriter, request *http.Request) {
@@ -56,7 +91,7 @@ func Start(writter http.ResponseWriter, request *http.Request) {
 
 	config.Id = uuid.NewV4()
 
-	err = validateConfig(config)
+	err = ValidateConfig(config)
 	if err != nil {
 		scenariolib.Error.Print(err.Error())
 		http.Error(writter, err.Error(), http.StatusBadRequest)
@@ -68,27 +103,71 @@ func Start(writter http.ResponseWriter, request *http.Request) {
 		http.Error(writter, err.Error(), http.StatusTeapot)
 		return
 	}
-	scenariolib.Info.Println("Current Configuration : \n" + string(out))
+	job := NewJob(config, tenantFromRequest(request))
+	jobLogger(job).Infof("Current Configuration : \n%s", out)
 
-	timer := time.NewTimer(time.Duration(config.TimeToLive) * time.Minute)
-	quitChannel := make(chan bool)
-	go func() {
-		<-timer.C
-		scenariolib.Info.Printf("Timer Timed Out")
-		close(quitChannel)
-	}()
-	quitChannels[config.Id] = quitChannel
-	worker := NewWorker(config, quitChannel, random, config.Id)
-	err = workPool.PostWork(&worker)
+	err = admit(job, waitFromRequest(request))
 	if err != nil {
-		scenariolib.Error.Printf("Error : %v\n", err)
+		writeAdmissionError(writter, err)
+		return
+	}
+	writter.Header().Add("Content-Type", "application/json")
+	if job.State == JOBBACKLOGGED {
+		writter.WriteHeader(http.StatusAccepted)
 	}
 	json.NewEncoder(writter).Encode(map[string]interface{}{
 		"workerID": config.Id,
+		"state":    job.State,
 	})
 }
 
-func validateConfig(config *explorerlib.Config) error {
+// waitFromRequest is true when the caller asked with ?wait=true for the job to
+// wait in the backlog if the queue is full
+func waitFromRequest(request *http.Request) bool {
+	return request.URL.Query().Get("wait") == "true"
+}
+
+// writeAdmissionError tells the caller why a job was not admitted, with the
+// depth of the queue and an estimate of the wait before it has room when it
+// is full.
+func writeAdmissionError(writter http.ResponseWriter, err error) {
+	switch err {
+	case ErrShuttingDown:
+		http.Error(writter, err.Error(), http.StatusServiceUnavailable)
+	case ErrQueueFull:
+		wait := workPool.EstimatedWait()
+		writter.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writter.Header().Add("Content-Type", "application/json")
+		writter.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(writter).Encode(map[string]interface{}{
+			"error":         err.Error(),
+			"queuedWork":    workPool.QueuedWork(),
+			"queueLength":   workPool.QueueLength,
+			"estimatedWait": wait.Truncate(time.Second).String(),
+		})
+	default:
+		scenariolib.Error.Printf("Error : %v\n", err)
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ValidateConfig checks the required fields of a start request and replaces
+// the out of bounds values by their default. The paths of the request should
+// stay in the directories of the server.
+func ValidateConfig(config *explorerlib.Config) error {
+	err := ValidateLocalConfig(config)
+	if err != nil {
+		return err
+	}
+	return validatePaths(config)
+}
+
+// ValidateLocalConfig checks a start request like ValidateConfig, for a
+// request run on the machine of its author the paths can go anywhere.
+func ValidateLocalConfig(config *explorerlib.Config) error {
+	if config.UabotConfig != nil {
+		return validateUabotConfig(config)
+	}
 	if config.OriginLevels == nil {
 		return errors.New("Origin Level 1 Missing")
 	} else {
@@ -101,31 +180,61 @@ func validateConfig(config *explorerlib.Config) error {
 	if config.SearchEndpoint == "" {
 		return errors.New("searchEndpoint Missing")
 	}
-	if config.SearchToken == "" {
+	if config.SearchToken == "" && config.SearchArchiveMode != explorerlib.REPLAYARCHIVE {
 		return errors.New("searchToken Missing")
 	}
+	err := validateSearchArchive(config)
+	if err != nil {
+		return err
+	}
 	if config.AnalyticsEndpoint == "" {
 		return errors.New("analyticsEndpoint Missing")
 	}
-	if config.AnalyticsToken == "" {
+	if config.AnalyticsToken == "" && !config.PlanOnly && sendsToCoveo(config) {
 		return errors.New("analyticsToken Missing")
 	}
-	if config.TimeToLive < MINIMUMTIMETOLIVE || config.TimeToLive > MAXIMUMTIMETOLIVE {
-		scenariolib.Warning.Printf("TimeToLive is out of bounds, should be in [%v,%v], will use default value of %v ", MINIMUMTIMETOLIVE, MAXIMUMTIMETOLIVE, DEFAULTIMETOLIVE)
-		config.TimeToLive = DEFAULTIMETOLIVE
+	err = validateEventSink(config)
+	if err != nil {
+		return err
+	}
+	validateSeed(config)
+	err = validateTrafficProfile(config)
+	if err != nil {
+		return err
+	}
+	err = validateTarget(config)
+	if err != nil {
+		return err
+	}
+	err = validateTimeToLive(config)
+	if err != nil {
+		return err
 	}
+	validatePriority(config)
 	if config.AverageNumberOfWordsPerQuery < MINIMUMNUMBERWORDSPERQUERY || config.AverageNumberOfWordsPerQuery > MAXIMUMNUMBERWORDSPERQUERY {
 		scenariolib.Warning.Printf("AverageNumberOfWordsPerQuery is out of bounds, should be in [%v,%v], will use default value of %v ", MINIMUMNUMBERWORDSPERQUERY, MAXIMUMNUMBERWORDSPERQUERY, DEFAULTNUMBERWORDSPERQUERY)
 		config.AverageNumberOfWordsPerQuery = DEFAULTNUMBERWORDSPERQUERY
 	}
 	if config.DocumentsExplorationPercentage < MINIMUMDOCUMENTEXPLORATIONPERCENT || config.DocumentsExplorationPercentage > MAXIMUMDOCUMENTEXPLORATIONPERCENT {
-		scenariolib.Warning.Printf("DocumentsExplorationPercentage is out of bounds, should be in [0%,100%], will use default value of %f %%", DEFAULTDOCUMENTEXPLORATIONPERCENT*100)
+		scenariolib.Warning.Printf("DocumentsExplorationPercentage is out of bounds, should be in [0%%,100%%], will use default value of %f %%", DEFAULTDOCUMENTEXPLORATIONPERCENT*100)
 		config.DocumentsExplorationPercentage = DEFAULTDOCUMENTEXPLORATIONPERCENT
 	}
 	if config.NumberOfQueryByLanguage < MINIMUMNUMBEROFQUERYPERLANGUAGE || config.NumberOfQueryByLanguage > MAXIMUMNUMBEROFQUERYPERLANGUAGE {
 		scenariolib.Warning.Printf("NumberOfQueryByLanguage is out of bounds, should be in [%v,%v], will use default value of %v ", MINIMUMNUMBEROFQUERYPERLANGUAGE, MAXIMUMNUMBEROFQUERYPERLANGUAGE, DEFAULTNUMBEROFQUERYPERLANGUAGE)
 		config.NumberOfQueryByLanguage = DEFAULTNUMBEROFQUERYPERLANGUAGE
 	}
+	if config.QueryAttemptsPerLanguage < config.NumberOfQueryByLanguage {
+		if config.QueryAttemptsPerLanguage != 0 {
+			scenariolib.Warning.Printf("QueryAttemptsPerLanguage should be at least NumberOfQueryByLanguage, will use default value of %v ", DEFAULTQUERYATTEMPTSPERQUERY*config.NumberOfQueryByLanguage)
+		}
+		config.QueryAttemptsPerLanguage = DEFAULTQUERYATTEMPTSPERQUERY * config.NumberOfQueryByLanguage
+	}
+	if config.MinimumQueriesPerLanguage < 1 || config.MinimumQueriesPerLanguage > config.NumberOfQueryByLanguage {
+		if config.MinimumQueriesPerLanguage != 0 {
+			scenariolib.Warning.Printf("MinimumQueriesPerLanguage is out of bounds, should be in [1,%v], will use default value of %v ", config.NumberOfQueryByLanguage, DEFAULTMINIMUMQUERIESPERLANGUAGE)
+		}
+		config.MinimumQueriesPerLanguage = DEFAULTMINIMUMQUERIESPERLANGUAGE
+	}
 	if config.FetchNumberOfResults < MINIMUMFETCHNUMBEROFRESULTS || config.FetchNumberOfResults > MAXIMUMFETCHNUMBEROFRESULTS {
 		scenariolib.Warning.Printf("FetchNumberOfResults is out of bounds, should be in [%v,%v], will use default value of %v ", MINIMUMFETCHNUMBEROFRESULTS, MAXIMUMFETCHNUMBEROFRESULTS, DEFAULTFETCHNUMBEROFRESULTS)
 		config.FetchNumberOfResults = DEFAULTFETCHNUMBEROFRESULTS
@@ -141,20 +250,243 @@ func validateConfig(config *explorerlib.Config) error {
 	if config.Org == "" {
 		return errors.New("Org Missing")
 	}
+	for _, scenario := range config.Scenarios {
+		err := scenario.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePaths(config *explorerlib.Config) error {
+	err := validateRelativePath("outputFilePath", config.OutputFilePath)
+	if err != nil {
+		return err
+	}
+	err = validateRelativePath("eventsFilePath", config.EventsFilePath)
+	if err != nil {
+		return err
+	}
+	return validateRelativePath("searchArchivePath", config.SearchArchivePath)
+}
+
+func validateSearchArchive(config *explorerlib.Config) error {
+	switch config.SearchArchiveMode {
+	case "":
+		return nil
+	case explorerlib.RECORDARCHIVE, explorerlib.REPLAYARCHIVE:
+		if config.SearchArchivePath == "" {
+			return errors.New("searchArchivePath Missing")
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown searchArchiveMode %q, should be record or replay", config.SearchArchiveMode)
+}
+
+// sendsToCoveo is true when the analytics events of the job go to the analytics endpoint
+func sendsToCoveo(config *explorerlib.Config) bool {
+	return config.EventSink == "" || config.EventSink == eventsink.COVEO
+}
+
+func validateEventSink(config *explorerlib.Config) error {
+	if !eventsink.IsValid(config.EventSink) {
+		return fmt.Errorf("Unknown eventSink %q, should be coveo, file or stdout", config.EventSink)
+	}
+	if config.EventSink == eventsink.FILE && config.EventsFilePath == "" {
+		scenariolib.Warning.Printf("EventsFilePath undefined, will be set to %s.events.json", config.Id.String())
+		config.EventsFilePath = config.Id.String() + ".events.json"
+	}
+	return nil
+}
+
+// validateSeed gives a seed to the jobs without one, so that any run can be reproduced
+func validateSeed(config *explorerlib.Config) {
+	if config.Seed == nil {
+		seed := time.Now().UnixNano()
+		config.Seed = &seed
+	}
+}
+
+func validateTrafficProfile(config *explorerlib.Config) error {
+	if config.TrafficProfile == nil {
+		return nil
+	}
+	return config.TrafficProfile.Validate()
+}
+
+func validateTarget(config *explorerlib.Config) error {
+	if config.Target == nil {
+		return nil
+	}
+	if config.Target.HasRate() && config.TrafficProfile != nil {
+		return errors.New("A target rate cannot be used with a traffic profile, give the target a budget only")
+	}
+	return config.Target.Validate()
+}
+
+// validateTimeToLive replaces a time to live out of bounds by its default, a
+// job with a budget target can live longer to reach it but fails instead.
+func validateTimeToLive(config *explorerlib.Config) error {
+	if config.Target != nil && config.Target.HasBudget() {
+		if config.TimeToLive < MINIMUMTIMETOLIVE || config.TimeToLive > MAXIMUMBUDGETTIMETOLIVE {
+			return fmt.Errorf("timeToLive of a job with a target budget should be in [%v,%v]", MINIMUMTIMETOLIVE, MAXIMUMBUDGETTIMETOLIVE)
+		}
+		return nil
+	}
+	if config.TimeToLive < MINIMUMTIMETOLIVE || config.TimeToLive > MAXIMUMTIMETOLIVE {
+		scenariolib.Warning.Printf("TimeToLive is out of bounds, should be in [%v,%v], will use default value of %v ", MINIMUMTIMETOLIVE, MAXIMUMTIMETOLIVE, DEFAULTIMETOLIVE)
+		config.TimeToLive = DEFAULTIMETOLIVE
+	}
+	return nil
+}
+
+func validatePriority(config *explorerlib.Config) {
+	if config.Priority < MINIMUMPRIORITY || config.Priority > MAXIMUMPRIORITY {
+		scenariolib.Warning.Printf("Priority is out of bounds, should be in [%v,%v], will use default value of %v ", MINIMUMPRIORITY, MAXIMUMPRIORITY, DEFAULTPRIORITY)
+		config.Priority = DEFAULTPRIORITY
+	}
+}
+
+// validateUabotConfig checks a job replaying a uabot configuration generated earlier
+func validateUabotConfig(config *explorerlib.Config) error {
+	uabotConfig := config.UabotConfig
+	if uabotConfig.OrgName == "" {
+		return errors.New("orgName Missing")
+	}
+	if len(uabotConfig.Scenarios) == 0 {
+		return errors.New("scenarios Missing")
+	}
+	for i, scenario := range uabotConfig.Scenarios {
+		if scenario == nil || len(scenario.Events) == 0 {
+			return fmt.Errorf("events Missing for scenario %v", i)
+		}
+		if scenario.Weight < 0 {
+			return fmt.Errorf("weight should be positive for scenario %v", i)
+		}
+	}
+	if len(uabotConfig.GoodQueries) == 0 && len(uabotConfig.GoodQueriesInLang) == 0 {
+		return errors.New("randomGoodQueries or goodQueriesInLanguage Missing")
+	}
+	if uabotConfig.SearchEndpoint == "" {
+		return errors.New("searchEndpoint Missing")
+	}
+	if uabotConfig.AnalyticsEndpoint == "" && sendsToCoveo(config) {
+		return errors.New("analyticsEndpoint Missing")
+	}
+	if config.SearchToken == "" {
+		return errors.New("searchToken Missing")
+	}
+	if config.AnalyticsToken == "" && sendsToCoveo(config) {
+		return errors.New("analyticsToken Missing")
+	}
+	err := validateSearchArchive(config)
+	if err != nil {
+		return err
+	}
+	err = validateEventSink(config)
+	if err != nil {
+		return err
+	}
+	validateSeed(config)
+	err = validateTrafficProfile(config)
+	if err != nil {
+		return err
+	}
+	err = validateTarget(config)
+	if err != nil {
+		return err
+	}
+	err = validateTimeToLive(config)
+	if err != nil {
+		return err
+	}
+	validatePriority(config)
+	config.Org = uabotConfig.OrgName
+	config.SearchEndpoint = uabotConfig.SearchEndpoint
+	config.AnalyticsEndpoint = uabotConfig.AnalyticsEndpoint
+	if config.OutputFilePath == "" {
+		config.OutputFilePath = config.Id.String() + ".json"
+	}
 	return nil
 }
 
+type fromConfigRequest struct {
+	Config         *scenariolib.Config         `json:"config"`
+	SearchToken    explorerlib.Secret          `json:"searchToken"`
+	AnalyticsToken explorerlib.Secret          `json:"analyticsToken"`
+	TimeToLive     int                         `json:"timeToLive"`
+	EventSink      string                      `json:"eventSink"`
+	EventsFilePath string                      `json:"eventsFilePath"`
+	Seed           *int64                      `json:"seed"`
+	TrafficProfile *explorerlib.TrafficProfile `json:"trafficProfile"`
+	Target         *explorerlib.Target         `json:"target"`
+	Priority       int                         `json:"priority"`
+}
+
+// StartFromConfig schedules a bot running a uabot configuration as is, without exploring the index
+func StartFromConfig(writter http.ResponseWriter, request *http.Request) {
+	startRequest := &fromConfigRequest{}
+	err := json.NewDecoder(request.Body).Decode(startRequest)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if startRequest.Config == nil {
+		http.Error(writter, "config Missing", http.StatusBadRequest)
+		return
+	}
+	config := &explorerlib.Config{
+		Id:             uuid.NewV4(),
+		SearchToken:    startRequest.SearchToken,
+		AnalyticsToken: startRequest.AnalyticsToken,
+		TimeToLive:     startRequest.TimeToLive,
+		UabotConfig:    startRequest.Config,
+		EventSink:      startRequest.EventSink,
+		EventsFilePath: startRequest.EventsFilePath,
+		Seed:           startRequest.Seed,
+		TrafficProfile: startRequest.TrafficProfile,
+		Target:         startRequest.Target,
+		Priority:       startRequest.Priority,
+	}
+	err = ValidateConfig(config)
+	if err != nil {
+		scenariolib.Error.Print(err.Error())
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job := NewJob(config, tenantFromRequest(request))
+	err = admit(job, waitFromRequest(request))
+	if err != nil {
+		writeAdmissionError(writter, err)
+		return
+	}
+	writter.Header().Add("Content-Type", "application/json")
+	if job.State == JOBBACKLOGGED {
+		writter.WriteHeader(http.StatusAccepted)
+	} else {
+		writter.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(writter).Encode(NewJobResource(job))
+}
+
 func Stop(writter http.ResponseWriter, request *http.Request) {
 	Vars := mux.Vars(request)
 	id, _ := uuid.FromString(Vars["id"])
-	close(quitChannels[id])
-	delete(quitChannels, id)
+	_, err := ownedJob(request, id)
+	if err == nil {
+		err = stopJob(id)
+	}
+	if err != nil {
+		http.Error(writter, err.Error(), statusFromJobError(err))
+	}
 }
 
 func GetInfo(writter http.ResponseWriter, request *http.Request) {
 	infos := map[string]interface{}{
 		"status":         "UP",
-		"botWorkerInfos": workPool.getInfo(),
+		"botWorkerInfos": workPool.getInfo(tenantFromRequest(request)),
 		"activeRoutines": fmt.Sprintf("%v/%v", workPool.ActiveRoutines(), workPool.NumberConcurrentRoutine),
 		"queuedWork":     fmt.Sprintf("%v/%v", workPool.QueuedWork(), workPool.QueueLength),
 	}
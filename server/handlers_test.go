@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/coveo/uabot/scenariolib"
+	"github.com/satori/go.uuid"
+)
+
+// uabotConfigJob is a valid job replaying a uabot configuration
+func uabotConfigJob() *explorerlib.Config {
+	return &explorerlib.Config{
+		Id:             uuid.NewV4(),
+		SearchToken:    "search-token",
+		AnalyticsToken: "analytics-token",
+		TimeToLive:     1,
+		UabotConfig: &scenariolib.Config{
+			OrgName:           "org",
+			SearchEndpoint:    "https://search.example.com/rest/search/",
+			AnalyticsEndpoint: "https://analytics.example.com/rest/v15/analytics/",
+			GoodQueries:       []string{"query"},
+			Scenarios:         []*scenariolib.Scenario{{Name: "search", Weight: 1, Events: []scenariolib.JSONEvent{{Type: "Search"}}}},
+		},
+	}
+}
+
+func TestValidateConfigOfAUabotConfiguration(t *testing.T) {
+	for name, test := range map[string]struct {
+		change func(config *explorerlib.Config)
+		valid  bool
+	}{
+		"valid":                      {func(config *explorerlib.Config) {}, true},
+		"without search endpoint":    {func(config *explorerlib.Config) { config.UabotConfig.SearchEndpoint = "" }, false},
+		"without analytics endpoint": {func(config *explorerlib.Config) { config.UabotConfig.AnalyticsEndpoint = "" }, false},
+		"without analytics endpoint to stdout": {func(config *explorerlib.Config) {
+			config.UabotConfig.AnalyticsEndpoint = ""
+			config.EventSink = "stdout"
+		}, true},
+		"with an events file out of the server": {func(config *explorerlib.Config) {
+			config.EventSink = "file"
+			config.EventsFilePath = "../events.json"
+		}, false},
+		"with an unknown search archive mode": {func(config *explorerlib.Config) { config.SearchArchiveMode = "rewind" }, false},
+	} {
+		config := uabotConfigJob()
+		test.change(config)
+		err := ValidateConfig(config)
+		if test.valid && err != nil {
+			t.Errorf("%v: ValidateConfig failed: %v", name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%v: ValidateConfig should fail", name)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	STATEEVENT    string = "state"
+	PROGRESSEVENT string = "progress"
+
+	EVENTBUFFERSIZE int = 64
+)
+
+type jobEvent struct {
+	name string
+	data interface{}
+	// last is true for the event ending the job, streams stop after it
+	last bool
+}
+
+// eventHub dispatches the events of every job to the clients listening to them
+type eventHub struct {
+	mutex       sync.Mutex
+	subscribers map[uuid.UUID]map[chan jobEvent]bool
+	progress    map[uuid.UUID]*explorerlib.ProgressRecorder
+}
+
+var events = &eventHub{
+	subscribers: make(map[uuid.UUID]map[chan jobEvent]bool),
+	progress:    make(map[uuid.UUID]*explorerlib.ProgressRecorder),
+}
+
+func (hub *eventHub) subscribe(id uuid.UUID) chan jobEvent {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	channel := make(chan jobEvent, EVENTBUFFERSIZE)
+	if hub.subscribers[id] == nil {
+		hub.subscribers[id] = make(map[chan jobEvent]bool)
+	}
+	hub.subscribers[id][channel] = true
+	return channel
+}
+
+func (hub *eventHub) unsubscribe(id uuid.UUID, channel chan jobEvent) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	delete(hub.subscribers[id], channel)
+	if len(hub.subscribers[id]) == 0 {
+		delete(hub.subscribers, id)
+	}
+}
+
+func (hub *eventHub) publish(id uuid.UUID, event jobEvent) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	for channel := range hub.subscribers[id] {
+		select {
+		case channel <- event:
+		default:
+			// A slow client misses events rather than slowing down the bot
+		}
+	}
+}
+
+// newProgress gives a new progress recorder to a job starting to run
+func (hub *eventHub) newProgress(id uuid.UUID) *explorerlib.ProgressRecorder {
+	recorder := explorerlib.NewProgressRecorder()
+	recorder.OnProgress(func(progress explorerlib.PhaseProgress) {
+		hub.publish(id, jobEvent{name: PROGRESSEVENT, data: progress})
+	})
+	hub.mutex.Lock()
+	hub.progress[id] = recorder
+	hub.mutex.Unlock()
+	return recorder
+}
+
+// progressOf returns the progress of the last run of a job, nil if it never ran
+func (hub *eventHub) progressOf(id uuid.UUID) []explorerlib.PhaseProgress {
+	hub.mutex.Lock()
+	recorder, ok := hub.progress[id]
+	hub.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	return recorder.Progress()
+}
+
+func (hub *eventHub) forget(id uuid.UUID) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	delete(hub.progress, id)
+}
+
+// saveJob saves the job and tells the listening clients about its new state,
+// the progress of a job is dropped once it is done. The caller must hold
+// jobsMutex.
+func saveJob(job *Job) error {
+	err := jobStore.Save(job)
+	if err != nil {
+		return err
+	}
+	events.publish(job.Config.Id, jobEvent{name: STATEEVENT, data: NewJobResource(job), last: job.IsDone()})
+	if job.IsDone() {
+		events.forget(job.Config.Id)
+	}
+	return nil
+}
+
+func writeEvent(writter http.ResponseWriter, name string, data interface{}) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writter, "event: %s\ndata: %s\n\n", name, bytes)
+	return err
+}
+
+// JobEvents streams the state and progress of a job as server-sent events
+// until the job ends or the client leaves.
+func JobEvents(writter http.ResponseWriter, request *http.Request) {
+	id, ok := jobIdFromRequest(writter, request)
+	if !ok {
+		return
+	}
+	flusher, ok := writter.(http.Flusher)
+	if !ok {
+		http.Error(writter, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	channel := events.subscribe(id)
+	defer events.unsubscribe(id, channel)
+	job, err := ownedJob(request, id)
+	if err != nil {
+		http.Error(writter, err.Error(), statusFromJobError(err))
+		return
+	}
+
+	writter.Header().Set("Content-Type", "text/event-stream")
+	writter.Header().Set("Cache-Control", "no-cache")
+	writter.Header().Set("Connection", "keep-alive")
+	err = writeEvent(writter, STATEEVENT, NewJobResource(job))
+	if err != nil || job.IsDone() {
+		return
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case event := <-channel:
+			err = writeEvent(writter, event.name, event.data)
+			if err != nil || event.last {
+				return
+			}
+			flusher.Flush()
+		case <-request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/coveo/uabot-server/logging"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+)
+
+// JobResource is the representation of a job returned by the API, it never
+// contains the tokens of the job.
+type JobResource struct {
+	Id                uuid.UUID                   `json:"id"`
+	State             JobState                    `json:"state"`
+	Org               string                      `json:"org"`
+	SearchEndpoint    string                      `json:"searchEndpoint"`
+	AnalyticsEndpoint string                      `json:"analyticsEndpoint"`
+	TimeToLive        int                         `json:"timeToLive"`
+	PlanOnly          bool                        `json:"planOnly"`
+	EventSink         string                      `json:"eventSink,omitempty"`
+	EventsFilePath    string                      `json:"eventsFilePath,omitempty"`
+	Seed              *int64                      `json:"seed,omitempty"`
+	TrafficProfile    *explorerlib.TrafficProfile `json:"trafficProfile,omitempty"`
+	Target            *explorerlib.Target         `json:"target,omitempty"`
+	// Actual is what a job with a target sent so far
+	Actual   *explorerlib.TargetCounts `json:"actual,omitempty"`
+	Priority int                       `json:"priority"`
+	// QueuePosition is the position of a queued job in the order the jobs are served, from 1
+	QueuePosition       int        `json:"queuePosition,omitempty"`
+	ScheduleId          *uuid.UUID `json:"scheduleId,omitempty"`
+	StartTime           time.Time  `json:"startTime"`
+	UpdateTime          time.Time  `json:"updateTime"`
+	EndTime             *time.Time `json:"endTime,omitempty"`
+	Deadline            *time.Time `json:"deadline,omitempty"`
+	RemainingTimeToLive string     `json:"remainingTimeToLive,omitempty"`
+	Error               string     `json:"error,omitempty"`
+
+	Progress     []explorerlib.PhaseProgress       `json:"progress,omitempty"`
+	QueryReports []explorerlib.LanguageQueryReport `json:"queryReports,omitempty"`
+}
+
+func NewJobResource(job *Job) JobResource {
+	resource := JobResource{
+		Id:                job.Config.Id,
+		State:             job.State,
+		Org:               job.Config.Org,
+		SearchEndpoint:    job.Config.SearchEndpoint,
+		AnalyticsEndpoint: job.Config.AnalyticsEndpoint,
+		TimeToLive:        job.Config.TimeToLive,
+		PlanOnly:          job.Config.PlanOnly,
+		EventSink:         job.Config.EventSink,
+		EventsFilePath:    job.Config.EventsFilePath,
+		Seed:              job.Config.Seed,
+		TrafficProfile:    job.Config.TrafficProfile,
+		Target:            job.Config.Target,
+		Actual:            job.TargetCounts,
+		Priority:          job.Config.Priority,
+		ScheduleId:        job.ScheduleId,
+		StartTime:         job.StartTime,
+		UpdateTime:        job.UpdateTime,
+		EndTime:           job.EndTime,
+		Error:             job.Error,
+		Progress:          events.progressOf(job.Config.Id),
+		QueryReports:      job.QueryReports,
+	}
+	if job.State == JOBQUEUED {
+		resource.QueuePosition = workPool.QueuePosition(job.Config.Id)
+	}
+	if job.IsActive() {
+		deadline := job.Deadline
+		resource.Deadline = &deadline
+	}
+	if !job.IsDone() {
+		resource.RemainingTimeToLive = job.RemainingTimeToLive().Truncate(time.Second).String()
+	}
+	return resource
+}
+
+func statusFromJobError(err error) int {
+	switch err {
+	case ErrJobNotFound:
+		return http.StatusNotFound
+	case ErrJobNotActive, ErrJobNotPaused:
+		return http.StatusConflict
+	case ErrShuttingDown:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func jobIdFromRequest(writter http.ResponseWriter, request *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.FromString(mux.Vars(request)["id"])
+	if err != nil {
+		http.Error(writter, "Invalid job id", http.StatusBadRequest)
+		return id, false
+	}
+	return id, true
+}
+
+// ownedJob gets a job of the tenant who sent the request, the jobs of other
+// tenants are not found.
+func ownedJob(request *http.Request, id uuid.UUID) (*Job, error) {
+	job, err := jobStore.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Tenant != tenantFromRequest(request) {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// jobFromRequest gets the job whose id is in the request path, writing the error if it cannot
+func jobFromRequest(writter http.ResponseWriter, request *http.Request) (*Job, bool) {
+	id, ok := jobIdFromRequest(writter, request)
+	if !ok {
+		return nil, false
+	}
+	job, err := ownedJob(request, id)
+	if err != nil {
+		http.Error(writter, err.Error(), statusFromJobError(err))
+		return nil, false
+	}
+	return job, true
+}
+
+func writeJob(writter http.ResponseWriter, job *Job) {
+	writter.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(writter).Encode(NewJobResource(job))
+}
+
+func ListJobs(writter http.ResponseWriter, request *http.Request) {
+	jobs, err := jobStore.List()
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartTime.Before(jobs[j].StartTime)
+	})
+	tenant := tenantFromRequest(request)
+	resources := make([]JobResource, 0, len(jobs))
+	for _, job := range jobs {
+		if job.Tenant == tenant {
+			resources = append(resources, NewJobResource(job))
+		}
+	}
+	writter.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(writter).Encode(resources)
+}
+
+func GetJob(writter http.ResponseWriter, request *http.Request) {
+	job, ok := jobFromRequest(writter, request)
+	if !ok {
+		return
+	}
+	writeJob(writter, job)
+}
+
+// GetJobConfig returns the uabot configuration generated by a job
+func GetJobConfig(writter http.ResponseWriter, request *http.Request) {
+	job, ok := jobFromRequest(writter, request)
+	if !ok {
+		return
+	}
+	config, err := ioutil.ReadFile(configPath(job.Config.Id))
+	if os.IsNotExist(err) {
+		http.Error(writter, "Configuration not generated yet", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writter.Header().Add("Content-Type", "application/json")
+	writter.Write(config)
+}
+
+// GetJobLogs returns the last lines logged by a job, all the lines kept
+// unless the lines parameter asks for fewer
+func GetJobLogs(writter http.ResponseWriter, request *http.Request) {
+	job, ok := jobFromRequest(writter, request)
+	if !ok {
+		return
+	}
+	lines := 0
+	if value := request.URL.Query().Get("lines"); value != "" {
+		var err error
+		lines, err = strconv.Atoi(value)
+		if err != nil || lines < 0 {
+			http.Error(writter, "lines should be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+	writter.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(writter).Encode(logging.Tail(job.Config.Id.String(), lines))
+}
+
+func PauseJob(writter http.ResponseWriter, request *http.Request) {
+	job, ok := jobFromRequest(writter, request)
+	if !ok {
+		return
+	}
+	job, err := pauseJob(job.Config.Id)
+	if err != nil {
+		http.Error(writter, err.Error(), statusFromJobError(err))
+		return
+	}
+	writeJob(writter, job)
+}
+
+func ResumeJob(writter http.ResponseWriter, request *http.Request) {
+	job, ok := jobFromRequest(writter, request)
+	if !ok {
+		return
+	}
+	job, err := resumeJob(job.Config.Id)
+	if err != nil {
+		http.Error(writter, err.Error(), statusFromJobError(err))
+		return
+	}
+	writeJob(writter, job)
+}
+
+func DeleteJob(writter http.ResponseWriter, request *http.Request) {
+	job, ok := jobFromRequest(writter, request)
+	if !ok {
+		return
+	}
+	err := deleteJob(job.Config.Id)
+	if err != nil {
+		http.Error(writter, err.Error(), statusFromJobError(err))
+		return
+	}
+	writter.WriteHeader(http.StatusNoContent)
+}
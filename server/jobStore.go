@@ -0,0 +1,335 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/coveo/uabot/scenariolib"
+	"github.com/satori/go.uuid"
+)
+
+type JobState string
+
+const (
+	JOBQUEUED          JobState = "queued"
+	JOBEXPLORING       JobState = "exploring"
+	JOBBUILDINGQUERIES JobState = "building-queries"
+	JOBRUNNING         JobState = "running"
+	JOBPAUSED          JobState = "paused"
+	// JOBBACKLOGGED waits for room in the queue of the work pool, its time to live is kept like when paused
+	JOBBACKLOGGED JobState = "backlogged"
+	JOBFINISHED   JobState = "finished"
+	JOBFAILED     JobState = "failed"
+)
+
+var ErrJobNotFound = errors.New("Job not found")
+
+// Job is the persisted representation of a bot, everything needed to
+// schedule it again after a restart.
+type Job struct {
+	Config     *explorerlib.Config `json:"config"`
+	Tenant     string              `json:"tenant,omitempty"`
+	State      JobState            `json:"state"`
+	StartTime  time.Time           `json:"startTime"`
+	UpdateTime time.Time           `json:"updateTime"`
+	EndTime    *time.Time          `json:"endTime,omitempty"`
+	Deadline   time.Time           `json:"deadline"`
+	// PausedTimeToLive is the time to live left when the job was paused or backlogged
+	PausedTimeToLive time.Duration `json:"pausedTimeToLive,omitempty"`
+	// Interrupted is true for a job paused by the server shutting down, it is resumed on boot
+	Interrupted bool   `json:"interrupted,omitempty"`
+	Error       string `json:"error,omitempty"`
+	// QueryReports tells how the queries of each language were found
+	QueryReports []explorerlib.LanguageQueryReport `json:"queryReports,omitempty"`
+	// ScheduleId is the schedule that started the job, if any
+	ScheduleId *uuid.UUID `json:"scheduleId,omitempty"`
+	// TargetCounts are what a job with a target actually sent, kept when it is paused or restored
+	TargetCounts *explorerlib.TargetCounts `json:"targetCounts,omitempty"`
+}
+
+func NewJob(config *explorerlib.Config, tenant string) *Job {
+	now := time.Now()
+	return &Job{
+		Config:     config,
+		Tenant:     tenant,
+		State:      JOBQUEUED,
+		StartTime:  now,
+		UpdateTime: now,
+		Deadline:   now.Add(time.Duration(config.TimeToLive) * time.Minute),
+	}
+}
+
+func (job *Job) IsDone() bool {
+	return job.State == JOBFINISHED || job.State == JOBFAILED
+}
+
+// IsActive is true while the job is waiting for or occupying a worker
+func (job *Job) IsActive() bool {
+	return !job.IsDone() && job.State != JOBPAUSED && job.State != JOBBACKLOGGED
+}
+
+func (job *Job) RemainingTimeToLive() time.Duration {
+	if job.State == JOBPAUSED || job.State == JOBBACKLOGGED {
+		return job.PausedTimeToLive
+	}
+	return job.Deadline.Sub(time.Now())
+}
+
+func (job *Job) SetState(state JobState) {
+	job.State = state
+	job.UpdateTime = time.Now()
+	if job.IsDone() {
+		endTime := job.UpdateTime
+		job.EndTime = &endTime
+	}
+}
+
+// JobStore keeps track of every job posted to the server.
+type JobStore interface {
+	Save(job *Job) error
+	Get(id uuid.UUID) (*Job, error)
+	List() ([]*Job, error)
+	Delete(id uuid.UUID) error
+}
+
+// fileJobStore saves every job as a JSON file named after its id, encrypted
+// when the store has a key.
+type fileJobStore struct {
+	directory string
+	sealer    sealer
+	mutex     sync.Mutex
+}
+
+// storedJob is the content of a job file. The tokens of the job are redacted
+// when it is marshalled so they are kept apart.
+type storedJob struct {
+	Job            *Job   `json:"job"`
+	SearchToken    string `json:"searchToken"`
+	AnalyticsToken string `json:"analyticsToken"`
+}
+
+// NewFileJobStore creates a store in the directory, key is nil to keep the
+// jobs in plain JSON or an AES key to encrypt them.
+func NewFileJobStore(directory string, key []byte) (JobStore, error) {
+	err := os.MkdirAll(directory, 0700)
+	if err != nil {
+		return nil, err
+	}
+	sealer, err := newSealer(key)
+	if err != nil {
+		return nil, err
+	}
+	return &fileJobStore{directory: directory, sealer: sealer}, nil
+}
+
+// sealer encrypts the files saved by the server when it has a key
+type sealer struct {
+	aead cipher.AEAD
+}
+
+func newSealer(key []byte) (sealer, error) {
+	if key == nil {
+		return sealer{}, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return sealer{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	return sealer{aead: aead}, err
+}
+
+// LoadEncryptionKey reads a hex encoded AES-256 key, as generated by `openssl rand -hex 32`
+func LoadEncryptionKey(path string) ([]byte, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(bytes)))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("Encryption key should be 32 bytes long")
+	}
+	return key, nil
+}
+
+func (sealer sealer) encrypt(plaintext []byte) ([]byte, error) {
+	if sealer.aead == nil {
+		return plaintext, nil
+	}
+	nonce := make([]byte, sealer.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return sealer.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (sealer sealer) decrypt(ciphertext []byte) ([]byte, error) {
+	if sealer.aead == nil {
+		return ciphertext, nil
+	}
+	if len(ciphertext) < sealer.aead.NonceSize() {
+		return nil, errors.New("Encrypted file is too short")
+	}
+	nonce := ciphertext[:sealer.aead.NonceSize()]
+	return sealer.aead.Open(nil, nonce, ciphertext[sealer.aead.NonceSize():], nil)
+}
+
+// writeFileAtomically writes to a temporary file first so a crash never leaves a truncated file behind
+func writeFileAtomically(path string, bytes []byte) error {
+	temporaryPath := path + ".tmp"
+	err := ioutil.WriteFile(temporaryPath, bytes, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, path)
+}
+
+func (store *fileJobStore) path(id uuid.UUID) string {
+	return filepath.Join(store.directory, id.String()+".json")
+}
+
+func (store *fileJobStore) Save(job *Job) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	bytes, err := json.Marshal(storedJob{
+		Job:            job,
+		SearchToken:    string(job.Config.SearchToken),
+		AnalyticsToken: string(job.Config.AnalyticsToken),
+	})
+	if err != nil {
+		return err
+	}
+	bytes, err = store.sealer.encrypt(bytes)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(store.path(job.Config.Id), bytes)
+}
+
+func (store *fileJobStore) Get(id uuid.UUID) (*Job, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.read(store.path(id))
+}
+
+func (store *fileJobStore) read(path string) (*Job, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	bytes, err = store.sealer.decrypt(bytes)
+	if err != nil {
+		return nil, err
+	}
+	stored := &storedJob{}
+	err = json.Unmarshal(bytes, stored)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Job == nil || stored.Job.Config == nil {
+		return nil, errors.New("Invalid job file: " + path)
+	}
+	stored.Job.Config.SearchToken = explorerlib.Secret(stored.SearchToken)
+	stored.Job.Config.AnalyticsToken = explorerlib.Secret(stored.AnalyticsToken)
+	return stored.Job, nil
+}
+
+func (store *fileJobStore) List() ([]*Job, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	files, err := ioutil.ReadDir(store.directory)
+	if err != nil {
+		return nil, err
+	}
+	jobs := []*Job{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(store.directory, file.Name())
+		job, err := store.read(path)
+		if err != nil {
+			// a corrupt file, or one saved with another key, does not hide the other jobs
+			scenariolib.Error.Printf("Skipping the job file %v : %v", path, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (store *fileJobStore) Delete(id uuid.UUID) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	err := os.Remove(store.path(id))
+	if os.IsNotExist(err) {
+		return ErrJobNotFound
+	}
+	return err
+}
+
+// memoryJobStore is used when persistence is disabled, jobs are lost on restart.
+type memoryJobStore struct {
+	jobs  map[uuid.UUID]Job
+	mutex sync.Mutex
+}
+
+func NewMemoryJobStore() JobStore {
+	return &memoryJobStore{jobs: make(map[uuid.UUID]Job)}
+}
+
+func (store *memoryJobStore) Save(job *Job) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.jobs[job.Config.Id] = *job
+	return nil
+}
+
+func (store *memoryJobStore) Get(id uuid.UUID) (*Job, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	job, ok := store.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	return &job, nil
+}
+
+func (store *memoryJobStore) List() ([]*Job, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	jobs := make([]*Job, 0, len(store.jobs))
+	for _, job := range store.jobs {
+		job := job
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func (store *memoryJobStore) Delete(id uuid.UUID) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	delete(store.jobs, id)
+	return nil
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/satori/go.uuid"
+)
+
+func TestSealerRoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	sealer, err := newSealer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte(`{"config":{"searchToken":"secret"}}`)
+	ciphertext, err := sealer.encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, []byte("secret")) {
+		t.Error("the encrypted file contains the plaintext")
+	}
+	decrypted, err := sealer.decrypt(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("decrypted %q, want %q", decrypted, plaintext)
+	}
+
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := sealer.decrypt(ciphertext); err == nil {
+		t.Error("a tampered file should not decrypt")
+	}
+	other, _ := newSealer(bytes.Repeat([]byte{8}, 32))
+	if _, err := other.decrypt(ciphertext); err == nil {
+		t.Error("a file should not decrypt with another key")
+	}
+	if _, err := sealer.decrypt([]byte("short")); err == nil {
+		t.Error("a file shorter than the nonce should not decrypt")
+	}
+}
+
+func TestSealerWithoutKeyKeepsPlaintext(t *testing.T) {
+	sealer, err := newSealer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte(`{"id":"job"}`)
+	ciphertext, err := sealer.encrypt(plaintext)
+	if err != nil || !bytes.Equal(ciphertext, plaintext) {
+		t.Errorf("encrypt without a key = %q, %v, want the plaintext", ciphertext, err)
+	}
+}
+
+func TestFileJobStoreEncryptsTheJobs(t *testing.T) {
+	directory, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	key := bytes.Repeat([]byte{7}, 32)
+	store, err := NewFileJobStore(directory, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := NewJob(&explorerlib.Config{Id: uuid.NewV4(), SearchToken: "search-secret", AnalyticsToken: "analytics-secret", TimeToLive: 1}, "tenant")
+	err = store.Save(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ioutil.ReadFile(filepath.Join(directory, job.Config.Id.String()+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(file, []byte("secret")) || bytes.Contains(file, []byte("tenant")) {
+		t.Error("the job file is not encrypted")
+	}
+	saved, err := store.Get(job.Config.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Tenant != "tenant" || saved.Config.SearchToken != "search-secret" || saved.Config.AnalyticsToken != "analytics-secret" {
+		t.Errorf("read back %+v with tokens %q and %q", saved, saved.Config.SearchToken, saved.Config.AnalyticsToken)
+	}
+
+	other, err := NewFileJobStore(directory, bytes.Repeat([]byte{8}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Get(job.Config.Id); err == nil {
+		t.Error("a job should not be read with another key")
+	}
+}
+
+func TestFileJobStoreListSkipsUnreadableFiles(t *testing.T) {
+	directory, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	store, err := NewFileJobStore(directory, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := NewJob(&explorerlib.Config{Id: uuid.NewV4(), TimeToLive: 1}, "tenant")
+	err = store.Save(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(directory, uuid.NewV4().String()+".json"), []byte("{corrupt"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Config.Id != job.Config.Id {
+		t.Errorf("listed %v jobs, want the readable job only", len(jobs))
+	}
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coveo/uabot-server/logging"
+	"github.com/coveo/uabot-server/metrics"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	ErrJobNotActive = errors.New("Job is not queued or running")
+	ErrJobNotPaused = errors.New("Job is not paused")
+)
+
+// quitSignal cancels the context of a bot, whether it is triggered by a stop,
+// a pause, the server shutting down or the time to live running out.
+type quitSignal struct {
+	context context.Context
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	// logger tags the lines about the bot with its job
+	logger *logging.Logger
+}
+
+func newQuitSignal(timeToLive time.Duration, logger *logging.Logger) *quitSignal {
+	signal := &quitSignal{logger: logger}
+	// the deadline tells the bot how long it has left to spend its budget
+	signal.context, signal.cancel = context.WithDeadline(context.Background(), time.Now().Add(timeToLive))
+	signal.timer = time.AfterFunc(timeToLive, func() {
+		signal.logger.Infof("Timer Timed Out")
+		signal.close()
+	})
+	return signal
+}
+
+func (signal *quitSignal) close() {
+	signal.timer.Stop()
+	signal.cancel()
+}
+
+func (signal *quitSignal) isClosed() bool {
+	return signal.context.Err() != nil
+}
+
+// jobsMutex protects quitChannels and every read-modify-write of the job store
+var jobsMutex sync.Mutex
+
+// jobLogger tags the logs with the job, they can be listed with GET /jobs/{id}/logs
+func jobLogger(job *Job) *logging.Logger {
+	return logging.ForJob(job.Config.Id.String(), job.Config.Org)
+}
+
+// RestoreJobs puts back in the work pool every job that was not done when the
+// server stopped, with whatever time to live it had left. A job that cannot
+// be restored does not stop the others, the errors are returned together.
+func RestoreJobs() error {
+	jobs, err := jobStore.List()
+	if err != nil {
+		return err
+	}
+	failures := []string{}
+	for _, job := range jobs {
+		err = restoreJob(job)
+		if err != nil {
+			jobLogger(job).Errorf("Cannot restore job : %v", err)
+			failures = append(failures, job.Config.Id.String()+" : "+err.Error())
+		}
+	}
+	drainBacklog()
+	if len(failures) > 0 {
+		return fmt.Errorf("%v jobs not restored, %v", len(failures), strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+func restoreJob(job *Job) error {
+	if job.State == JOBBACKLOGGED {
+		jobsMutex.Lock()
+		enterBacklog(job)
+		jobsMutex.Unlock()
+		return nil
+	}
+	if job.State == JOBPAUSED && job.Interrupted {
+		jobLogger(job).Infof("Resuming job with %v left to live", job.RemainingTimeToLive())
+		_, err := resumeJob(job.Config.Id)
+		return err
+	}
+	if !job.IsActive() {
+		return nil
+	}
+	if job.RemainingTimeToLive() <= 0 {
+		jobLogger(job).Infof("Job expired while the server was down")
+		job.SetState(JOBFINISHED)
+		return jobStore.Save(job)
+	}
+	jobLogger(job).Infof("Restoring job with %v left to live", job.RemainingTimeToLive())
+	job.SetState(JOBQUEUED)
+	return admit(job, true)
+}
+
+// scheduleLocked saves the job and posts it to the work pool, the bot is
+// stopped once the job deadline is reached. The caller must hold jobsMutex,
+// see admit for the jobs rejected by a full queue.
+func scheduleLocked(job *Job) error {
+	if draining {
+		return ErrShuttingDown
+	}
+	err := saveJob(job)
+	if err != nil {
+		return err
+	}
+	signal := newQuitSignal(job.RemainingTimeToLive(), jobLogger(job))
+	quitChannels[job.Config.Id] = signal
+	worker := NewWorker(job, signal)
+	err = workPool.PostWork(job, &worker)
+	if err != nil {
+		// the bot will never run, its timer must not end a later run of the job
+		signal.close()
+		delete(quitChannels, job.Config.Id)
+	}
+	return err
+}
+
+// updateJob applies the update to the stored job, the update returns false
+// to leave the job untouched.
+func updateJob(id uuid.UUID, update func(job *Job) bool) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	job, err := jobStore.Get(id)
+	if err != nil {
+		logging.ForJob(id.String(), "").Errorf("Cannot update job : %v", err)
+		return
+	}
+	if !update(job) {
+		return
+	}
+	err = saveJob(job)
+	if err != nil {
+		jobLogger(job).Errorf("Cannot update job : %v", err)
+	}
+}
+
+// setJobState moves a job to a new state unless it was paused or ended meanwhile
+func setJobState(id uuid.UUID, state JobState) {
+	updateJob(id, func(job *Job) bool {
+		if !job.IsActive() {
+			return false
+		}
+		job.SetState(state)
+		return true
+	})
+}
+
+// startWork is called by a worker before running its bot, it returns false if
+// the job should not run anymore.
+func startWork(id uuid.UUID, signal *quitSignal) bool {
+	jobsMutex.Lock()
+	current := quitChannels[id] == signal
+	closed := signal.isClosed()
+	if current && !closed {
+		// Counted under the lock so Shutdown never waits before a bot is counted
+		runningBots.Add(1)
+	}
+	jobsMutex.Unlock()
+	if !current {
+		// The job was paused and resumed while this worker was queued,
+		// or the server is shutting down
+		return false
+	}
+	if closed {
+		endWork(id, signal, nil)
+		return false
+	}
+	setJobState(id, JOBEXPLORING)
+	return true
+}
+
+// endWork records how the bot of a job ended.
+func endWork(id uuid.UUID, signal *quitSignal, err error) {
+	jobsMutex.Lock()
+	if quitChannels[id] == signal {
+		signal.close()
+		delete(quitChannels, id)
+	}
+	jobsMutex.Unlock()
+	updateJob(id, func(job *Job) bool {
+		if !job.IsActive() {
+			return false
+		}
+		if err != nil {
+			metrics.Errors.WithLabelValues(metrics.JOBERROR).Inc()
+			job.Error = err.Error()
+			job.SetState(JOBFAILED)
+		} else {
+			job.SetState(JOBFINISHED)
+		}
+		return true
+	})
+}
+
+func stopJob(id uuid.UUID) error {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	job, err := jobStore.Get(id)
+	if err != nil {
+		return err
+	}
+	if signal, ok := quitChannels[id]; ok {
+		signal.close()
+		delete(quitChannels, id)
+	}
+	workPool.Cancel(id)
+	leaveBacklog(id)
+	if job.IsDone() {
+		return nil
+	}
+	job.SetState(JOBFINISHED)
+	return saveJob(job)
+}
+
+func pauseJob(id uuid.UUID) (*Job, error) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	job, err := jobStore.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !job.IsActive() {
+		return job, ErrJobNotActive
+	}
+	if signal, ok := quitChannels[id]; ok {
+		signal.close()
+		delete(quitChannels, id)
+	}
+	workPool.Cancel(id)
+	job.PausedTimeToLive = job.RemainingTimeToLive()
+	job.SetState(JOBPAUSED)
+	return job, saveJob(job)
+}
+
+func resumeJob(id uuid.UUID) (*Job, error) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	job, err := jobStore.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.State != JOBPAUSED {
+		return job, ErrJobNotPaused
+	}
+	job.Deadline = time.Now().Add(job.PausedTimeToLive)
+	job.PausedTimeToLive = 0
+	job.Interrupted = false
+	job.SetState(JOBQUEUED)
+	return job, admitLocked(job, true)
+}
+
+func deleteJob(id uuid.UUID) error {
+	err := stopJob(id)
+	if err != nil {
+		return err
+	}
+	events.forget(id)
+	logging.Forget(id.String())
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	return jobStore.Delete(id)
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"github.com/coveo/uabot-server/autobot"
+	"github.com/coveo/uabot-server/metrics"
+	"github.com/coveo/uabot/scenariolib"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	jobsDescription = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.NAMESPACE, "", "jobs"),
+		"Jobs by state and org.",
+		[]string{"state", "org"}, nil)
+	remainingTimeToLiveDescription = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.NAMESPACE, "", "job_remaining_time_to_live_seconds"),
+		"Time left to live of the jobs that are not done, by job id and org.",
+		[]string{"job", "org"}, nil)
+)
+
+// jobsCollector reads the jobs from the store on every scrape
+type jobsCollector struct{}
+
+func (jobsCollector) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- jobsDescription
+	descriptions <- remainingTimeToLiveDescription
+}
+
+func (jobsCollector) Collect(collected chan<- prometheus.Metric) {
+	jobs, err := jobStore.List()
+	if err != nil {
+		scenariolib.Error.Printf("Cannot list jobs for the metrics : %v", err)
+		return
+	}
+	type stateAndOrg struct{ state, org string }
+	counts := make(map[stateAndOrg]int)
+	for _, job := range jobs {
+		counts[stateAndOrg{string(job.State), job.Config.Org}]++
+		if !job.IsDone() {
+			collected <- prometheus.MustNewConstMetric(remainingTimeToLiveDescription, prometheus.GaugeValue,
+				job.RemainingTimeToLive().Seconds(), job.Config.Id.String(), job.Config.Org)
+		}
+	}
+	for key, count := range counts {
+		collected <- prometheus.MustNewConstMetric(jobsDescription, prometheus.GaugeValue, float64(count), key.state, key.org)
+	}
+}
+
+// registerMetrics exposes the jobs and the work pool, and counts the analytics events sent by the bots
+func registerMetrics() {
+	prometheus.MustRegister(
+		jobsCollector{},
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metrics.NAMESPACE,
+			Name:      "workpool_queued_work",
+			Help:      "Bots waiting in the queue of the work pool.",
+		}, func() float64 { return float64(workPool.QueuedWork()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metrics.NAMESPACE,
+			Name:      "workpool_active_routines",
+			Help:      "Routines of the work pool running a bot.",
+		}, func() float64 { return float64(workPool.ActiveRoutines()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metrics.NAMESPACE,
+			Name:      "workpool_routines",
+			Help:      "Routines of the work pool.",
+		}, func() float64 { return float64(workPool.NumberConcurrentRoutine) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metrics.NAMESPACE,
+			Name:      "workpool_queue_length",
+			Help:      "Maximum number of bots waiting in the queue of the work pool.",
+		}, func() float64 { return float64(workPool.QueueLength) }),
+	)
+	scenariolib.EventSent = func(uatoken string, org string, eventType string, err error) {
+		metrics.ObserveAnalyticsEvent(org, eventType, err)
+		autobot.EventSent(uatoken, eventType, err)
+	}
+}
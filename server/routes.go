@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type Route struct {
@@ -22,8 +23,14 @@ func NewRouter() *mux.Router {
 			Methods(route.Method).
 			Path(route.Pattern).
 			Name(route.Name).
-			Handler(route.HandlerFunc)
+			Handler(authenticate(route.HandlerFunc))
 	}
+	// Scrapers do not have an API key, the metrics are not split by tenant
+	router.
+		Methods("GET").
+		Path("/metrics").
+		Name("Metrics").
+		Handler(promhttp.Handler())
 
 	return router
 }
@@ -47,4 +54,100 @@ var routes = Routes{
 		"/info",
 		GetInfo,
 	},
+	Route{
+		"StartFromConfig",
+		"POST",
+		"/jobs/from-config",
+		StartFromConfig,
+	},
+	Route{
+		"ListJobs",
+		"GET",
+		"/jobs",
+		ListJobs,
+	},
+	Route{
+		"GetJob",
+		"GET",
+		"/jobs/{id}",
+		GetJob,
+	},
+	Route{
+		"PauseJob",
+		"POST",
+		"/jobs/{id}/pause",
+		PauseJob,
+	},
+	Route{
+		"ResumeJob",
+		"POST",
+		"/jobs/{id}/resume",
+		ResumeJob,
+	},
+	Route{
+		"GetJobConfig",
+		"GET",
+		"/jobs/{id}/config",
+		GetJobConfig,
+	},
+	Route{
+		"GetJobLogs",
+		"GET",
+		"/jobs/{id}/logs",
+		GetJobLogs,
+	},
+	Route{
+		"JobEvents",
+		"GET",
+		"/jobs/{id}/events",
+		JobEvents,
+	},
+	Route{
+		"DeleteJob",
+		"DELETE",
+		"/jobs/{id}",
+		DeleteJob,
+	},
+	Route{
+		"ListSchedules",
+		"GET",
+		"/schedules",
+		ListSchedules,
+	},
+	Route{
+		"CreateSchedule",
+		"POST",
+		"/schedules",
+		CreateSchedule,
+	},
+	Route{
+		"GetSchedule",
+		"GET",
+		"/schedules/{id}",
+		GetSchedule,
+	},
+	Route{
+		"DeleteSchedule",
+		"DELETE",
+		"/schedules/{id}",
+		DeleteSchedule,
+	},
+	Route{
+		"ListVocabularies",
+		"GET",
+		"/vocabularies",
+		ListVocabularies,
+	},
+	Route{
+		"DeleteVocabularies",
+		"DELETE",
+		"/vocabularies",
+		DeleteVocabularies,
+	},
+	Route{
+		"DeleteVocabulary",
+		"DELETE",
+		"/vocabularies/{id}",
+		DeleteVocabulary,
+	},
 }
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/gorilla/mux"
+	"github.com/satori/go.uuid"
+)
+
+// ScheduleResource is the representation of a schedule returned by the API,
+// its configuration never contains the tokens.
+type ScheduleResource struct {
+	Id              uuid.UUID           `json:"id"`
+	Cron            string              `json:"cron"`
+	Timezone        string              `json:"timezone,omitempty"`
+	MissedRunPolicy MissedRunPolicy     `json:"missedRunPolicy"`
+	Config          *explorerlib.Config `json:"config"`
+	CreationTime    time.Time           `json:"creationTime"`
+	NextRun         *time.Time          `json:"nextRun,omitempty"`
+	History         []ScheduleRun       `json:"history"`
+}
+
+func NewScheduleResource(recurring *Schedule) ScheduleResource {
+	resource := ScheduleResource{
+		Id:              recurring.Id,
+		Cron:            recurring.Cron,
+		Timezone:        recurring.Timezone,
+		MissedRunPolicy: recurring.MissedRunPolicy,
+		Config:          recurring.Config,
+		CreationTime:    recurring.CreationTime,
+		History:         recurring.History,
+	}
+	if !recurring.NextRun.IsZero() {
+		nextRun := recurring.NextRun
+		resource.NextRun = &nextRun
+	}
+	if resource.History == nil {
+		resource.History = []ScheduleRun{}
+	}
+	return resource
+}
+
+type scheduleRequest struct {
+	Cron            string              `json:"cron"`
+	Timezone        string              `json:"timezone"`
+	MissedRunPolicy MissedRunPolicy     `json:"missedRunPolicy"`
+	Config          *explorerlib.Config `json:"config"`
+}
+
+// validateScheduleRequest checks the schedule and the configuration of its jobs
+func validateScheduleRequest(scheduleRequest *scheduleRequest) error {
+	if scheduleRequest.Cron == "" {
+		return errors.New("cron Missing")
+	}
+	if scheduleRequest.Config == nil {
+		return errors.New("config Missing")
+	}
+	switch scheduleRequest.MissedRunPolicy {
+	case "":
+		scheduleRequest.MissedRunPolicy = SKIPMISSEDRUNS
+	case SKIPMISSEDRUNS, RUNMISSEDONCE:
+	default:
+		return fmt.Errorf("Unknown missedRunPolicy %q, should be skip or run-once", scheduleRequest.MissedRunPolicy)
+	}
+	// the configuration is validated again, with its defaults, for every job
+	config := *scheduleRequest.Config
+	config.Id = uuid.NewV4()
+	return ValidateConfig(&config)
+}
+
+// CreateSchedule saves a schedule starting a job with the configuration every time the cron expression matches
+func CreateSchedule(writter http.ResponseWriter, request *http.Request) {
+	scheduleRequest := &scheduleRequest{}
+	err := json.NewDecoder(request.Body).Decode(scheduleRequest)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = validateScheduleRequest(scheduleRequest)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	recurring := &Schedule{
+		Id:              uuid.NewV4(),
+		Tenant:          tenantFromRequest(request),
+		Cron:            scheduleRequest.Cron,
+		Timezone:        scheduleRequest.Timezone,
+		MissedRunPolicy: scheduleRequest.MissedRunPolicy,
+		Config:          scheduleRequest.Config,
+		CreationTime:    time.Now(),
+	}
+	recurring.NextRun, err = recurring.next(recurring.CreationTime)
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusBadRequest)
+		return
+	}
+	schedulesMutex.Lock()
+	err = schedules.Save(recurring)
+	schedulesMutex.Unlock()
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writter.Header().Add("Content-Type", "application/json")
+	writter.WriteHeader(http.StatusCreated)
+	json.NewEncoder(writter).Encode(NewScheduleResource(recurring))
+}
+
+func ListSchedules(writter http.ResponseWriter, request *http.Request) {
+	all, err := schedules.List()
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].CreationTime.Before(all[j].CreationTime)
+	})
+	tenant := tenantFromRequest(request)
+	resources := make([]ScheduleResource, 0, len(all))
+	for _, recurring := range all {
+		if recurring.Tenant == tenant {
+			resources = append(resources, NewScheduleResource(recurring))
+		}
+	}
+	writter.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(writter).Encode(resources)
+}
+
+// scheduleFromRequest gets the schedule of the tenant whose id is in the
+// request path, writing the error if it cannot
+func scheduleFromRequest(writter http.ResponseWriter, request *http.Request) (*Schedule, bool) {
+	id, err := uuid.FromString(mux.Vars(request)["id"])
+	if err != nil {
+		http.Error(writter, "Invalid schedule id", http.StatusBadRequest)
+		return nil, false
+	}
+	recurring, err := schedules.Get(id)
+	if err == nil && recurring.Tenant != tenantFromRequest(request) {
+		err = ErrScheduleNotFound
+	}
+	if err == ErrScheduleNotFound {
+		http.Error(writter, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return recurring, true
+}
+
+// GetSchedule returns a schedule with the history of the jobs it started
+func GetSchedule(writter http.ResponseWriter, request *http.Request) {
+	recurring, ok := scheduleFromRequest(writter, request)
+	if !ok {
+		return
+	}
+	writter.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(writter).Encode(NewScheduleResource(recurring))
+}
+
+// DeleteSchedule forgets a schedule, the jobs it started keep running
+func DeleteSchedule(writter http.ResponseWriter, request *http.Request) {
+	recurring, ok := scheduleFromRequest(writter, request)
+	if !ok {
+		return
+	}
+	schedulesMutex.Lock()
+	err := schedules.Delete(recurring.Id)
+	schedulesMutex.Unlock()
+	if err == ErrScheduleNotFound {
+		http.Error(writter, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writter.WriteHeader(http.StatusNoContent)
+}
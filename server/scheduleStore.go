@@ -0,0 +1,251 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coveo/uabot-server/cron"
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/satori/go.uuid"
+)
+
+// MissedRunPolicy tells what a schedule does with the runs missed while the server was down
+type MissedRunPolicy string
+
+const (
+	// SKIPMISSEDRUNS records the missed runs in the history without starting them
+	SKIPMISSEDRUNS MissedRunPolicy = "skip"
+	// RUNMISSEDONCE starts a single job on boot for all the runs missed
+	RUNMISSEDONCE MissedRunPolicy = "run-once"
+
+	// MAXIMUMSCHEDULEHISTORY is the number of runs kept in the history of a schedule
+	MAXIMUMSCHEDULEHISTORY int = 100
+)
+
+var ErrScheduleNotFound = errors.New("Schedule not found")
+
+// ScheduleRun is a time a schedule was due, with the job it started
+type ScheduleRun struct {
+	Time time.Time `json:"time"`
+	// FireTime is when the job was started, later than Time for a missed run
+	FireTime time.Time  `json:"fireTime"`
+	JobId    *uuid.UUID `json:"jobId,omitempty"`
+	Missed   bool       `json:"missed,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// Schedule starts a job with its configuration every time its cron expression matches
+type Schedule struct {
+	Id     uuid.UUID `json:"id"`
+	Tenant string    `json:"tenant,omitempty"`
+	Cron   string    `json:"cron"`
+	// Timezone the cron expression is read in, UTC if empty
+	Timezone        string              `json:"timezone,omitempty"`
+	MissedRunPolicy MissedRunPolicy     `json:"missedRunPolicy"`
+	Config          *explorerlib.Config `json:"config"`
+	CreationTime    time.Time           `json:"creationTime"`
+	NextRun         time.Time           `json:"nextRun"`
+	// History holds the last runs, oldest first
+	History []ScheduleRun `json:"history"`
+}
+
+// next returns the first time the schedule is due after the given time
+func (schedule *Schedule) next(after time.Time) (time.Time, error) {
+	expression, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	location, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := expression.Next(after.In(location))
+	if next.IsZero() {
+		return next, errors.New("Cron expression never matches: " + schedule.Cron)
+	}
+	return next, nil
+}
+
+func (schedule *Schedule) record(run ScheduleRun) {
+	schedule.History = append(schedule.History, run)
+	if len(schedule.History) > MAXIMUMSCHEDULEHISTORY {
+		schedule.History = schedule.History[len(schedule.History)-MAXIMUMSCHEDULEHISTORY:]
+	}
+}
+
+// ScheduleStore keeps the schedules created on the server
+type ScheduleStore interface {
+	Save(schedule *Schedule) error
+	Get(id uuid.UUID) (*Schedule, error)
+	List() ([]*Schedule, error)
+	Delete(id uuid.UUID) error
+}
+
+// fileScheduleStore saves every schedule as a JSON file named after its id,
+// encrypted when the store has a key.
+type fileScheduleStore struct {
+	directory string
+	sealer    sealer
+	mutex     sync.Mutex
+}
+
+// storedSchedule is the content of a schedule file, the tokens are kept apart like in storedJob
+type storedSchedule struct {
+	Schedule       *Schedule `json:"schedule"`
+	SearchToken    string    `json:"searchToken"`
+	AnalyticsToken string    `json:"analyticsToken"`
+}
+
+// NewFileScheduleStore creates a store in the directory, key is nil to keep
+// the schedules in plain JSON or an AES key to encrypt them.
+func NewFileScheduleStore(directory string, key []byte) (ScheduleStore, error) {
+	err := os.MkdirAll(directory, 0700)
+	if err != nil {
+		return nil, err
+	}
+	sealer, err := newSealer(key)
+	if err != nil {
+		return nil, err
+	}
+	return &fileScheduleStore{directory: directory, sealer: sealer}, nil
+}
+
+func (store *fileScheduleStore) path(id uuid.UUID) string {
+	return filepath.Join(store.directory, id.String()+".json")
+}
+
+func (store *fileScheduleStore) Save(schedule *Schedule) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	bytes, err := json.Marshal(storedSchedule{
+		Schedule:       schedule,
+		SearchToken:    string(schedule.Config.SearchToken),
+		AnalyticsToken: string(schedule.Config.AnalyticsToken),
+	})
+	if err != nil {
+		return err
+	}
+	bytes, err = store.sealer.encrypt(bytes)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(store.path(schedule.Id), bytes)
+}
+
+func (store *fileScheduleStore) Get(id uuid.UUID) (*Schedule, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.read(store.path(id))
+}
+
+func (store *fileScheduleStore) read(path string) (*Schedule, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrScheduleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	bytes, err = store.sealer.decrypt(bytes)
+	if err != nil {
+		return nil, err
+	}
+	stored := &storedSchedule{}
+	err = json.Unmarshal(bytes, stored)
+	if err != nil {
+		return nil, err
+	}
+	if stored.Schedule == nil || stored.Schedule.Config == nil {
+		return nil, errors.New("Invalid schedule file: " + path)
+	}
+	stored.Schedule.Config.SearchToken = explorerlib.Secret(stored.SearchToken)
+	stored.Schedule.Config.AnalyticsToken = explorerlib.Secret(stored.AnalyticsToken)
+	return stored.Schedule, nil
+}
+
+func (store *fileScheduleStore) List() ([]*Schedule, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	files, err := ioutil.ReadDir(store.directory)
+	if err != nil {
+		return nil, err
+	}
+	schedules := []*Schedule{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		schedule, err := store.read(filepath.Join(store.directory, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+func (store *fileScheduleStore) Delete(id uuid.UUID) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	err := os.Remove(store.path(id))
+	if os.IsNotExist(err) {
+		return ErrScheduleNotFound
+	}
+	return err
+}
+
+// memoryScheduleStore is used when persistence is disabled, schedules are lost on restart.
+type memoryScheduleStore struct {
+	schedules map[uuid.UUID]Schedule
+	mutex     sync.Mutex
+}
+
+func NewMemoryScheduleStore() ScheduleStore {
+	return &memoryScheduleStore{schedules: make(map[uuid.UUID]Schedule)}
+}
+
+func (store *memoryScheduleStore) Save(schedule *Schedule) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	saved := *schedule
+	saved.History = append([]ScheduleRun{}, schedule.History...)
+	store.schedules[schedule.Id] = saved
+	return nil
+}
+
+func (store *memoryScheduleStore) Get(id uuid.UUID) (*Schedule, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	schedule, ok := store.schedules[id]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	return &schedule, nil
+}
+
+func (store *memoryScheduleStore) List() ([]*Schedule, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	schedules := make([]*Schedule, 0, len(store.schedules))
+	for _, schedule := range store.schedules {
+		schedule := schedule
+		schedules = append(schedules, &schedule)
+	}
+	return schedules, nil
+}
+
+func (store *memoryScheduleStore) Delete(id uuid.UUID) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.schedules[id]; !ok {
+		return ErrScheduleNotFound
+	}
+	delete(store.schedules, id)
+	return nil
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coveo/uabot-server/logging"
+	"github.com/coveo/uabot/scenariolib"
+	"github.com/satori/go.uuid"
+)
+
+var (
+	// schedulesMutex protects every read-modify-write of the schedule store,
+	// it is taken before jobsMutex when both are needed
+	schedulesMutex sync.Mutex
+	stopScheduler  chan bool
+)
+
+// StartScheduler applies the missed run policy of the schedules that were due
+// while the server was down, then starts the jobs of every schedule when
+// they are due until the server shuts down.
+func StartScheduler() error {
+	err := catchUpSchedules(time.Now())
+	if err != nil {
+		return err
+	}
+	stopScheduler = make(chan bool)
+	go runScheduler(stopScheduler)
+	return nil
+}
+
+func runScheduler(stop chan bool) {
+	for {
+		// cron expressions match minutes, wake up at the start of the next one
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case now = <-timer.C:
+		}
+		err := fireDueSchedules(now)
+		if err != nil {
+			scenariolib.Error.Printf("Cannot fire the schedules : %v", err)
+		}
+	}
+}
+
+// catchUpSchedules handles the schedules due before the server booted
+func catchUpSchedules(now time.Time) error {
+	return updateDueSchedules(now, func(recurring *Schedule) {
+		scheduleLogger(recurring).Infof("Schedule missed its run of %v", recurring.NextRun)
+		if recurring.MissedRunPolicy == RUNMISSEDONCE {
+			fireSchedule(recurring, now, true)
+			return
+		}
+		recurring.record(ScheduleRun{Time: recurring.NextRun, FireTime: now, Missed: true, Error: "Skipped, the server was down"})
+	})
+}
+
+func fireDueSchedules(now time.Time) error {
+	return updateDueSchedules(now, func(recurring *Schedule) {
+		fireSchedule(recurring, now, false)
+	})
+}
+
+// updateDueSchedules calls fire with every schedule due at the given time, then moves it to its next run
+func updateDueSchedules(now time.Time, fire func(recurring *Schedule)) error {
+	schedulesMutex.Lock()
+	defer schedulesMutex.Unlock()
+	due, err := schedules.List()
+	if err != nil {
+		return err
+	}
+	for _, recurring := range due {
+		// a schedule whose expression stopped matching has no next run
+		if recurring.NextRun.IsZero() || recurring.NextRun.After(now) {
+			continue
+		}
+		fire(recurring)
+		recurring.NextRun, err = recurring.next(now)
+		if err != nil {
+			scheduleLogger(recurring).Errorf("Cannot find the next run of the schedule : %v", err)
+		}
+		err = schedules.Save(recurring)
+		if err != nil {
+			scheduleLogger(recurring).Errorf("Cannot save the schedule : %v", err)
+		}
+	}
+	return nil
+}
+
+// scheduleLogger tags the logs with the schedule
+func scheduleLogger(recurring *Schedule) *logging.Logger {
+	return logging.ForSchedule(recurring.Id.String(), recurring.Config.Org)
+}
+
+// fireSchedule starts a job with the configuration of the schedule and records it in the history
+func fireSchedule(recurring *Schedule, now time.Time, missed bool) {
+	run := ScheduleRun{Time: recurring.NextRun, FireTime: now, Missed: missed}
+	job, err := newScheduledJob(recurring)
+	if err == nil {
+		jobId := job.Config.Id
+		run.JobId = &jobId
+		// a scheduled job waits in the backlog rather than being dropped by a full queue
+		err = admit(job, true)
+	}
+	if err != nil {
+		if job != nil {
+			jobLogger(job).Errorf("Cannot start the job of schedule %v : %v", recurring.Id, err)
+		} else {
+			scheduleLogger(recurring).Errorf("Cannot start the job of the schedule : %v", err)
+		}
+		run.Error = err.Error()
+	} else {
+		jobLogger(job).Infof("Started by schedule %v", recurring.Id)
+	}
+	recurring.record(run)
+}
+
+// newScheduledJob creates a job from a copy of the configuration of the schedule
+func newScheduledJob(recurring *Schedule) (*Job, error) {
+	config := *recurring.Config
+	config.Id = uuid.NewV4()
+	err := ValidateConfig(&config)
+	if err != nil {
+		return nil, err
+	}
+	job := NewJob(&config, recurring.Tenant)
+	scheduleId := recurring.Id
+	job.ScheduleId = &scheduleId
+	return job, nil
+}
+
+// stopSchedules stops starting jobs, the schedules due meanwhile are caught up on the next boot
+func stopSchedules() {
+	schedulesMutex.Lock()
+	defer schedulesMutex.Unlock()
+	if stopScheduler != nil {
+		close(stopScheduler)
+		stopScheduler = nil
+	}
+}
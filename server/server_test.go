@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/coveo/uabot-server/fakecoveo"
+	"github.com/coveo/uabot-server/logging"
+	"github.com/coveo/uabot/scenariolib"
+)
+
+// JOBTESTTIMEOUT bounds the wait for a job of the end to end tests to finish
+const JOBTESTTIMEOUT = 30 * time.Second
+
+var (
+	fakeServer *fakecoveo.Server
+	fake       *httptest.Server
+	api        *httptest.Server
+)
+
+// TestMain runs the server against a fake Coveo, Init registers the metrics
+// so it is called once for all the tests.
+func TestMain(m *testing.M) {
+	scenariolib.InitLogger(ioutil.Discard, ioutil.Discard, os.Stderr, os.Stderr)
+	logging.Configure(logging.TEXTFORMAT, ioutil.Discard, os.Stderr, os.Stderr)
+	// the bots read the stopwords from the root of the repository
+	err := os.Chdir("..")
+	if err != nil {
+		panic(err)
+	}
+	directory, err := ioutil.TempDir("", "uabot-server")
+	if err != nil {
+		panic(err)
+	}
+	testDirectories := Directories{
+		Configs:        filepath.Join(directory, "configs"),
+		Events:         filepath.Join(directory, "events"),
+		SearchArchives: filepath.Join(directory, "search-archives"),
+	}
+	err = testDirectories.Create()
+	if err != nil {
+		panic(err)
+	}
+	fakeServer = fakecoveo.NewServer(fakecoveo.NewCorpus(1, 200))
+	fake = httptest.NewServer(fakeServer.Handler())
+	Init(NewWorkPool(2, 10, ConcurrencyCaps{}), NewMemoryJobStore(), NewMemoryScheduleStore(), nil, testDirectories, nil, nil, explorerlib.DefaultRetryPolicy())
+	api = httptest.NewServer(NewRouter())
+
+	code := m.Run()
+	api.Close()
+	fake.Close()
+	os.RemoveAll(directory)
+	os.Exit(code)
+}
+
+// startJob starts a job on the fake with the settings given on top of a small exploration
+func startJob(t *testing.T, settings map[string]interface{}) string {
+	config := map[string]interface{}{
+		"searchEndpoint":           fake.URL + fakecoveo.SEARCHPATH,
+		"searchToken":              "search-token",
+		"analyticsEndpoint":        fake.URL + fakecoveo.ANALYTICSPATH,
+		"analyticsToken":           "analytics-token",
+		"org":                      "fakeorg",
+		"originLevels":             map[string][]string{"Search": {"All"}},
+		"fields":                   []string{"@syssource"},
+		"explorationRatio":         0.1,
+		"fetchQueryNumber":         10,
+		"numberOfQueryPerLanguage": 5,
+		"avgNumberWordsPerQuery":   1,
+		"timeToLive":               1,
+		"seed":                     42,
+	}
+	for key, value := range settings {
+		config[key] = value
+	}
+	body, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.Post(api.URL+"/start", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(response.Body)
+		t.Fatalf("POST /start returned %v: %s", response.StatusCode, message)
+	}
+	started := struct {
+		WorkerID string `json:"workerID"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return started.WorkerID
+}
+
+// getJSON decodes the response of a GET on the server into result
+func getJSON(t *testing.T, path string, result interface{}) {
+	response, err := http.Get(api.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(response.Body)
+		t.Fatalf("GET %v returned %v: %s", path, response.StatusCode, message)
+	}
+	err = json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitForJob polls a job until it is done
+func waitForJob(t *testing.T, id string) JobResource {
+	deadline := time.Now().Add(JOBTESTTIMEOUT)
+	for {
+		job := JobResource{}
+		getJSON(t, "/jobs/"+id, &job)
+		if job.State == JOBFINISHED || job.State == JOBFAILED {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %v still %v after %v", id, job.State, JOBTESTTIMEOUT)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestPlanOnlyJobExploresTheIndex(t *testing.T) {
+	queries, events := len(fakeServer.Queries()), len(fakeServer.Events())
+	id := startJob(t, map[string]interface{}{"planOnly": true})
+
+	job := waitForJob(t, id)
+	if job.State != JOBFINISHED {
+		t.Fatalf("job %v, want %v: %v", job.State, JOBFINISHED, job.Error)
+	}
+	if len(fakeServer.Queries()) == queries {
+		t.Error("the job did not query the fake index")
+	}
+	config := scenariolib.Config{}
+	getJSON(t, "/jobs/"+id+"/config", &config)
+	if config.SearchEndpoint != fake.URL+fakecoveo.SEARCHPATH || config.AnalyticsEndpoint != fake.URL+fakecoveo.ANALYTICSPATH {
+		t.Errorf("config sends to %v and %v, want the fake", config.SearchEndpoint, config.AnalyticsEndpoint)
+	}
+	if len(config.GoodQueriesInLang) == 0 || len(config.Scenarios) == 0 {
+		t.Errorf("config has queries in %v languages and %v scenarios, want some of both", len(config.GoodQueriesInLang), len(config.Scenarios))
+	}
+	if sent := len(fakeServer.Events()) - events; sent != 0 {
+		t.Errorf("a plan only job sent %v events", sent)
+	}
+}
+
+func TestJobWithABudgetSendsItsEventsToTheFake(t *testing.T) {
+	events := fakeServer.EventCounts()["search"]
+	id := startJob(t, map[string]interface{}{"target": map[string]interface{}{"events": 1, "eventType": "search"}})
+
+	job := waitForJob(t, id)
+	if job.State != JOBFINISHED {
+		t.Fatalf("job %v, want %v: %v", job.State, JOBFINISHED, job.Error)
+	}
+	if job.Actual == nil || job.Actual.Events < 1 {
+		t.Errorf("job actually sent %+v, want at least 1 search event", job.Actual)
+	}
+	if received := fakeServer.EventCounts()["search"] - events; received < 1 {
+		t.Errorf("the fake received %v search events, want at least 1", received)
+	}
+}
+
+func TestStartRejectsAPathLeavingTheServerDirectories(t *testing.T) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"searchEndpoint":    fake.URL + fakecoveo.SEARCHPATH,
+		"searchToken":       "search-token",
+		"analyticsEndpoint": fake.URL + fakecoveo.ANALYTICSPATH,
+		"org":               "fakeorg",
+		"originLevels":      map[string][]string{"Search": {"All"}},
+		"planOnly":          true,
+		"outputFilePath":    "../../etc/config.json",
+	})
+	response, err := http.Post(api.URL+"/start", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /start with a configuration out of the server returned %v, want %v", response.StatusCode, http.StatusBadRequest)
+	}
+}
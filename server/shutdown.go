@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/coveo/uabot/scenariolib"
+	"github.com/satori/go.uuid"
+)
+
+var ErrShuttingDown = errors.New("Server is shutting down")
+
+var (
+	// draining is set once the server stops accepting jobs, protected by jobsMutex
+	draining bool
+	// runningBots counts the bots between startWork and endWork
+	runningBots sync.WaitGroup
+)
+
+// Shutdown stops the schedules and accepting jobs and stops every bot, keeping
+// the time to live they had left so they are resumed on the next boot. It
+// waits for the bots to return for at most the grace period and tells if they
+// all did.
+func Shutdown(gracePeriod time.Duration) bool {
+	stopSchedules()
+	jobsMutex.Lock()
+	draining = true
+	for id, signal := range quitChannels {
+		err := interruptLocked(id)
+		if err != nil {
+			signal.logger.Errorf("Cannot checkpoint job : %v", err)
+		}
+		signal.close()
+		delete(quitChannels, id)
+	}
+	jobsMutex.Unlock()
+
+	done := make(chan bool)
+	go func() {
+		runningBots.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		scenariolib.Info.Printf("Every bot stopped")
+		return true
+	case <-time.After(gracePeriod):
+		scenariolib.Warning.Printf("Bots still running after %v", gracePeriod)
+		return false
+	}
+}
+
+// interruptLocked pauses a job until the next boot, the caller must hold jobsMutex
+func interruptLocked(id uuid.UUID) error {
+	job, err := jobStore.Get(id)
+	if err != nil {
+		return err
+	}
+	if !job.IsActive() {
+		return nil
+	}
+	job.PausedTimeToLive = job.RemainingTimeToLive()
+	job.Interrupted = true
+	job.SetState(JOBPAUSED)
+	return saveJob(job)
+}
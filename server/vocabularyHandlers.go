@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/gorilla/mux"
+)
+
+// tenantVocabularies returns the vocabularies of the tenant who sent the request, nil if the cache is disabled
+func tenantVocabularies(writter http.ResponseWriter, request *http.Request) (*explorerlib.VocabularyCache, bool) {
+	cache, err := vocabularies.ForTenant(tenantFromRequest(request))
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return cache, true
+}
+
+func ListVocabularies(writter http.ResponseWriter, request *http.Request) {
+	cache, ok := tenantVocabularies(writter, request)
+	if !ok {
+		return
+	}
+	summaries := []explorerlib.VocabularySummary{}
+	if cache != nil {
+		var err error
+		summaries, err = cache.List()
+		if err != nil {
+			http.Error(writter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writter.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(writter).Encode(summaries)
+}
+
+func DeleteVocabularies(writter http.ResponseWriter, request *http.Request) {
+	cache, ok := tenantVocabularies(writter, request)
+	if !ok {
+		return
+	}
+	if cache != nil {
+		err := cache.DeleteAll()
+		if err != nil {
+			http.Error(writter, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	writter.WriteHeader(http.StatusNoContent)
+}
+
+func DeleteVocabulary(writter http.ResponseWriter, request *http.Request) {
+	cache, ok := tenantVocabularies(writter, request)
+	if !ok {
+		return
+	}
+	if cache == nil {
+		http.Error(writter, explorerlib.ErrVocabularyNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	err := cache.Delete(mux.Vars(request)["id"])
+	if err == explorerlib.ErrVocabularyNotFound {
+		http.Error(writter, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(writter, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writter.WriteHeader(http.StatusNoContent)
+}
@@ -1,30 +1,363 @@
 package server
 
 import (
-	"github.com/goinggo/workpool"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/satori/go.uuid"
 )
 
-const routine = "bot"
+var ErrQueueFull = errors.New("Work pool queue is full")
+
+// ConcurrencyCaps limit the routines running the bots of a tenant or an org,
+// so that a tenant posting many bots cannot take every routine. A cap of 0
+// does not limit.
+type ConcurrencyCaps struct {
+	Tenant int
+	Org    int
+	// ByTenant and ByOrg hold the caps of the tenants and orgs that do not use the default
+	ByTenant map[string]int
+	ByOrg    map[string]int
+}
+
+func (caps ConcurrencyCaps) forTenant(tenant string) int {
+	if routines, ok := caps.ByTenant[tenant]; ok {
+		return routines
+	}
+	return caps.Tenant
+}
+
+func (caps ConcurrencyCaps) forOrg(org string) int {
+	if routines, ok := caps.ByOrg[org]; ok {
+		return routines
+	}
+	return caps.Org
+}
+
+// allow is true when the tenant and the org of the work run fewer routines than their cap
+func (caps ConcurrencyCaps) allow(work *queuedWork, runningByTenant map[string]int, runningByOrg map[string]int) bool {
+	tenantCap := caps.forTenant(work.tenant)
+	if tenantCap > 0 && runningByTenant[work.tenant] >= tenantCap {
+		return false
+	}
+	orgCap := caps.forOrg(work.org)
+	return orgCap <= 0 || runningByOrg[work.org] < orgCap
+}
+
+// ParseConcurrencyCaps reads caps written as name1=2,name2=5
+func ParseConcurrencyCaps(value string) (map[string]int, error) {
+	caps := make(map[string]int)
+	if value == "" {
+		return caps, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Invalid cap %q, should be name=routines", pair)
+		}
+		routines, err := strconv.Atoi(parts[1])
+		if err != nil || routines < 0 {
+			return nil, fmt.Errorf("Invalid cap %q, should be name=routines", pair)
+		}
+		caps[parts[0]] = routines
+	}
+	return caps, nil
+}
+
+// queuedWork is a worker waiting for a routine of the work pool
+type queuedWork struct {
+	worker   Worker
+	id       uuid.UUID
+	tenant   string
+	org      string
+	priority int
+	// deadline is when the bot stops at the latest
+	deadline time.Time
+}
+
+// workQueue holds the waiting work of every tenant, by decreasing priority
+// then in order of arrival. The tenants take turns, starting with the tenant
+// at next.
+type workQueue struct {
+	byTenant map[string][]*queuedWork
+	tenants  []string
+	next     int
+}
+
+func newWorkQueue() *workQueue {
+	return &workQueue{byTenant: make(map[string][]*queuedWork)}
+}
+
+func (queue *workQueue) push(work *queuedWork) {
+	works, ok := queue.byTenant[work.tenant]
+	if !ok {
+		queue.tenants = append(queue.tenants, work.tenant)
+	}
+	i := sort.Search(len(works), func(i int) bool { return works[i].priority < work.priority })
+	works = append(works, nil)
+	copy(works[i+1:], works[i:])
+	works[i] = work
+	queue.byTenant[work.tenant] = works
+}
+
+// pick removes and returns the work served next, the first work that can run
+// of the highest priority, taking turns between the tenants that have work of
+// that priority. It returns nil when no work can run.
+func (queue *workQueue) pick(canRun func(work *queuedWork) bool) *queuedWork {
+	var picked *queuedWork
+	pickedTurn := 0
+	for turn := 0; turn < len(queue.tenants); turn++ {
+		tenant := queue.tenants[(queue.next+turn)%len(queue.tenants)]
+		for _, work := range queue.byTenant[tenant] {
+			if !canRun(work) {
+				continue
+			}
+			if picked == nil || work.priority > picked.priority {
+				picked, pickedTurn = work, turn
+			}
+			break
+		}
+	}
+	if picked != nil {
+		queue.remove(picked.id)
+		queue.next = (queue.next + pickedTurn + 1) % len(queue.tenants)
+	}
+	return picked
+}
+
+// remove takes the work of the job out of the queue, it returns false if it was not queued
+func (queue *workQueue) remove(id uuid.UUID) bool {
+	for tenant, works := range queue.byTenant {
+		for i, work := range works {
+			if work.id == id {
+				queue.byTenant[tenant] = append(works[:i:i], works[i+1:]...)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (queue *workQueue) clone() *workQueue {
+	clone := &workQueue{
+		byTenant: make(map[string][]*queuedWork, len(queue.byTenant)),
+		tenants:  append([]string{}, queue.tenants...),
+		next:     queue.next,
+	}
+	for tenant, works := range queue.byTenant {
+		clone.byTenant[tenant] = append([]*queuedWork{}, works...)
+	}
+	return clone
+}
 
+// WorkPool runs the bots on a fixed number of routines, serving the queued
+// bots by priority and taking turns between the tenants, within the
+// concurrency caps of their tenant and org.
 type WorkPool struct {
-	goinggoWorkpool         *workpool.WorkPool
 	workerInfo              []map[string]interface{}
 	NumberConcurrentRoutine int
 	QueueLength             int32
+	Caps                    ConcurrencyCaps
+
+	mutex           sync.Mutex
+	ready           *sync.Cond
+	queue           *workQueue
+	queued          int32
+	active          int32
+	running         map[*queuedWork]bool
+	runningByTenant map[string]int
+	runningByOrg    map[string]int
+	// positions caches the queue positions until the queue or the running bots change
+	positions map[uuid.UUID]int
+	// roomListener is called every time a work leaves the queue
+	roomListener func()
 }
 
-func NewWorkPool(numConcurrentRoutine int, queueLength int32) *WorkPool {
-	return &WorkPool{
-		goinggoWorkpool:         workpool.New(numConcurrentRoutine, queueLength),
+func NewWorkPool(numConcurrentRoutine int, queueLength int32, caps ConcurrencyCaps) *WorkPool {
+	workPool := &WorkPool{
 		workerInfo:              make([]map[string]interface{}, numConcurrentRoutine),
 		NumberConcurrentRoutine: numConcurrentRoutine,
 		QueueLength:             queueLength,
+		Caps:                    caps,
+		queue:                   newWorkQueue(),
+		running:                 make(map[*queuedWork]bool),
+		runningByTenant:         make(map[string]int),
+		runningByOrg:            make(map[string]int),
+	}
+	workPool.ready = sync.NewCond(&workPool.mutex)
+	for routine := 0; routine < numConcurrentRoutine; routine++ {
+		go workPool.run(routine)
+	}
+	return workPool
+}
+
+// OnRoom registers a function called every time a work leaves the queue,
+// without holding the lock of the work pool.
+func (workPool *WorkPool) OnRoom(listener func()) {
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
+	workPool.roomListener = listener
+}
+
+func (workPool *WorkPool) roomFreed() {
+	workPool.mutex.Lock()
+	listener := workPool.roomListener
+	workPool.mutex.Unlock()
+	if listener != nil {
+		listener()
+	}
+}
+
+// PostWork queues the worker of the job, it fails when the queue is full
+func (workPool *WorkPool) PostWork(job *Job, worker *Worker) error {
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
+	if workPool.queued >= workPool.QueueLength {
+		return ErrQueueFull
+	}
+	workPool.queue.push(&queuedWork{
+		worker:   *worker,
+		id:       job.Config.Id,
+		tenant:   job.Tenant,
+		org:      job.Config.Org,
+		priority: job.Config.Priority,
+		deadline: job.Deadline,
+	})
+	workPool.queued++
+	workPool.positions = nil
+	workPool.ready.Broadcast()
+	return nil
+}
+
+// Cancel takes the job out of the queue, it returns false if it was not queued
+func (workPool *WorkPool) Cancel(id uuid.UUID) bool {
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
+	if !workPool.queue.remove(id) {
+		return false
+	}
+	workPool.queued--
+	workPool.positions = nil
+	// the caller may hold the locks the listener takes
+	go workPool.roomFreed()
+	return true
+}
+
+func (workPool *WorkPool) run(routine int) {
+	for {
+		work := workPool.take()
+		workPool.roomFreed()
+		work.worker.DoWork(routine)
+		workPool.release(work)
+	}
+}
+
+// canRun is true when the tenant and the org of the work are under their cap
+func (workPool *WorkPool) canRun(work *queuedWork) bool {
+	return workPool.Caps.allow(work, workPool.runningByTenant, workPool.runningByOrg)
+}
+
+// take waits for a work that can run
+func (workPool *WorkPool) take() *queuedWork {
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
+	for {
+		work := workPool.queue.pick(workPool.canRun)
+		if work != nil {
+			workPool.queued--
+			workPool.active++
+			workPool.running[work] = true
+			workPool.runningByTenant[work.tenant]++
+			workPool.runningByOrg[work.org]++
+			workPool.positions = nil
+			return work
+		}
+		workPool.ready.Wait()
+	}
+}
+
+func (workPool *WorkPool) release(work *queuedWork) {
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
+	workPool.active--
+	delete(workPool.running, work)
+	workPool.runningByTenant[work.tenant]--
+	workPool.runningByOrg[work.org]--
+	workPool.positions = nil
+	// the work of the tenant or org may have been waiting for their cap
+	workPool.ready.Broadcast()
+}
+
+// EstimatedWait is the time until the queue has room, when the first running
+// bot reaches the end of its time to live, bots ending sooner shorten it.
+func (workPool *WorkPool) EstimatedWait() time.Duration {
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
+	if workPool.queued < workPool.QueueLength {
+		return 0
+	}
+	var wait time.Duration
+	found := false
+	for work := range workPool.running {
+		// a bot past its deadline is ending now
+		left := time.Until(work.deadline)
+		if left < 0 {
+			left = 0
+		}
+		if !found || left < wait {
+			wait, found = left, true
+		}
 	}
+	return wait
 }
 
-func (workPool *WorkPool) PostWork(worker *Worker) error {
-	return workPool.goinggoWorkpool.PostWork(routine, *worker)
+// QueuePosition returns the position of the job in the order the queue is
+// served, from 1, or 0 if it is not queued. A job whose tenant or org is at
+// its cap lets the jobs behind it go first, the jobs that cannot run until a
+// bot of their tenant or org ends come last.
+func (workPool *WorkPool) QueuePosition(id uuid.UUID) int {
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
+	if workPool.positions == nil {
+		workPool.positions = workPool.simulate()
+	}
+	return workPool.positions[id]
+}
+
+// simulate serves a copy of the queue within the caps, counting every work it
+// picks as running, and returns the position of every queued work.
+func (workPool *WorkPool) simulate() map[uuid.UUID]int {
+	positions := make(map[uuid.UUID]int)
+	queue := workPool.queue.clone()
+	runningByTenant := make(map[string]int)
+	for tenant, running := range workPool.runningByTenant {
+		runningByTenant[tenant] = running
+	}
+	runningByOrg := make(map[string]int)
+	for org, running := range workPool.runningByOrg {
+		runningByOrg[org] = running
+	}
+	canRun := func(work *queuedWork) bool { return workPool.Caps.allow(work, runningByTenant, runningByOrg) }
+	anyWork := func(work *queuedWork) bool { return true }
+	for position := 1; position <= int(workPool.queued); position++ {
+		work := queue.pick(canRun)
+		if work == nil {
+			// every work left waits for a bot of its tenant or org to end
+			work = queue.pick(anyWork)
+		}
+		if work == nil {
+			break
+		}
+		positions[work.id] = position
+		runningByTenant[work.tenant]++
+		runningByOrg[work.org]++
+	}
+	return positions
 }
 
 type WorkWrapper struct {
@@ -37,15 +370,24 @@ type WorkWrapper struct {
 func (_workWrapper WorkWrapper) DoWork(goRoutine int) {
 	info := _workWrapper.realWorker.bot.GetInfo()
 	info["workerId"] = _workWrapper.realWorker.id.String()
-	_workWrapper.workPool.workerInfo[goRoutine] = info
+	info["tenant"] = _workWrapper.realWorker.tenant
+	_workWrapper.workPool.setWorkerInfo(goRoutine, info)
 	_workWrapper.realWorker.DoWork(goRoutine)
-	_workWrapper.workPool.workerInfo[goRoutine] = nil
+	_workWrapper.workPool.setWorkerInfo(goRoutine, nil)
+}
+
+func (workPool *WorkPool) setWorkerInfo(routine int, info map[string]interface{}) {
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
+	workPool.workerInfo[routine] = info
 }
 
-func (workPool *WorkPool) getInfo() []map[string]interface{} {
+func (workPool *WorkPool) getInfo(tenant string) []map[string]interface{} {
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
 	filteredInfo := make([]map[string]interface{}, 0)
 	for _, info := range workPool.workerInfo {
-		if info != nil {
+		if info != nil && info["tenant"] == tenant {
 			filteredInfo = append(filteredInfo, info)
 		}
 	}
@@ -53,9 +395,13 @@ func (workPool *WorkPool) getInfo() []map[string]interface{} {
 }
 
 func (workPool *WorkPool) ActiveRoutines() int32 {
-	return workPool.goinggoWorkpool.ActiveRoutines()
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
+	return workPool.active
 }
 
 func (workPool *WorkPool) QueuedWork() int32 {
-	return workPool.goinggoWorkpool.QueuedWork()
+	workPool.mutex.Lock()
+	defer workPool.mutex.Unlock()
+	return workPool.queued
 }
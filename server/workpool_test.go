@@ -0,0 +1,135 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coveo/uabot-server/explorerlib"
+	"github.com/satori/go.uuid"
+)
+
+type nopWorker struct{}
+
+func (worker nopWorker) DoWork(goRoutine int) {}
+
+// queuedJob posts a job to a work pool without routines, it stays queued
+func queuedJob(t *testing.T, workPool *WorkPool, tenant string, org string, priority int) uuid.UUID {
+	job := NewJob(&explorerlib.Config{Id: uuid.NewV4(), Org: org, Priority: priority, TimeToLive: 1}, tenant)
+	var worker Worker = nopWorker{}
+	err := workPool.PostWork(job, &worker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job.Config.Id
+}
+
+func TestQueuePositionFollowsPriorityAndTurns(t *testing.T) {
+	workPool := NewWorkPool(0, 10, ConcurrencyCaps{})
+	a1 := queuedJob(t, workPool, "a", "org", 0)
+	a2 := queuedJob(t, workPool, "a", "org", 0)
+	b1 := queuedJob(t, workPool, "b", "org", 0)
+	urgent := queuedJob(t, workPool, "b", "org", 5)
+
+	want := map[uuid.UUID]int{urgent: 1, a1: 2, b1: 3, a2: 4}
+	for id, position := range want {
+		if got := workPool.QueuePosition(id); got != position {
+			t.Errorf("QueuePosition(%v) = %v, want %v", id, got, position)
+		}
+	}
+	if got := workPool.QueuePosition(uuid.NewV4()); got != 0 {
+		t.Errorf("QueuePosition of a job not queued = %v, want 0", got)
+	}
+}
+
+func TestQueuePositionLetsTheJobsUnderTheirCapGoFirst(t *testing.T) {
+	workPool := NewWorkPool(0, 10, ConcurrencyCaps{Tenant: 1, ByOrg: map[string]int{"small": 1}})
+	// tenant a is at its cap
+	workPool.runningByTenant["a"] = 1
+	a1 := queuedJob(t, workPool, "a", "org", 0)
+	b1 := queuedJob(t, workPool, "b", "org", 0)
+	b2 := queuedJob(t, workPool, "b", "org", 0)
+	c1 := queuedJob(t, workPool, "c", "small", 0)
+	c2 := queuedJob(t, workPool, "d", "small", 0)
+
+	// once b1 and c1 run, tenant b and org small are at their cap too and the
+	// jobs left come last, taking turns from the tenant after c
+	want := map[uuid.UUID]int{b1: 1, c1: 2, c2: 3, a1: 4, b2: 5}
+	for id, position := range want {
+		if got := workPool.QueuePosition(id); got != position {
+			t.Errorf("QueuePosition(%v) = %v, want %v", id, got, position)
+		}
+	}
+	if workPool.runningByTenant["a"] != 1 || workPool.runningByTenant["b"] != 0 {
+		t.Errorf("QueuePosition changed the running bots: %v", workPool.runningByTenant)
+	}
+}
+
+func TestQueuePositionChangesWhenACappedBotEnds(t *testing.T) {
+	workPool := NewWorkPool(0, 10, ConcurrencyCaps{Tenant: 1})
+	// a bot of tenant a is running, its tenant is at its cap
+	running := &queuedWork{id: uuid.NewV4(), tenant: "a", org: "org"}
+	workPool.running[running] = true
+	workPool.runningByTenant["a"]++
+	workPool.runningByOrg["org"]++
+	workPool.active++
+	a1 := queuedJob(t, workPool, "a", "org", 0)
+	b1 := queuedJob(t, workPool, "b", "org", 0)
+	if got := workPool.QueuePosition(a1); got != 2 {
+		t.Fatalf("QueuePosition of the capped job = %v, want 2", got)
+	}
+
+	workPool.release(running)
+	want := map[uuid.UUID]int{a1: 1, b1: 2}
+	for id, position := range want {
+		if got := workPool.QueuePosition(id); got != position {
+			t.Errorf("QueuePosition(%v) after the bot ended = %v, want %v", id, got, position)
+		}
+	}
+}
+
+func TestWorkQueuePick(t *testing.T) {
+	queue := newWorkQueue()
+	work := func(tenant string, org string, priority int) *queuedWork {
+		work := &queuedWork{id: uuid.NewV4(), tenant: tenant, org: org, priority: priority}
+		queue.push(work)
+		return work
+	}
+	a1 := work("a", "org", 0)
+	a2 := work("a", "org", 0)
+	b1 := work("b", "other", 0)
+	urgent := work("a", "org", 5)
+	anything := func(work *queuedWork) bool { return true }
+
+	if got := queue.pick(anything); got != urgent {
+		t.Fatalf("picked %+v first, want the work of the highest priority", got)
+	}
+	// tenant a was just served, b takes its turn
+	if got := queue.pick(anything); got != b1 {
+		t.Fatalf("picked %+v second, want the work of tenant b", got)
+	}
+	// the work that cannot run is skipped, not the tenant
+	if got := queue.pick(func(work *queuedWork) bool { return work != a1 }); got != a2 {
+		t.Fatalf("picked %+v third, want the work that can run", got)
+	}
+	if got := queue.pick(func(work *queuedWork) bool { return false }); got != nil {
+		t.Fatalf("picked %+v when no work can run, want nil", got)
+	}
+	if got := queue.pick(anything); got != a1 {
+		t.Fatalf("picked %+v last, want the work left", got)
+	}
+	if got := queue.pick(anything); got != nil {
+		t.Fatalf("picked %+v from an empty queue, want nil", got)
+	}
+}
+
+func TestEstimatedWaitOfABotPastItsDeadline(t *testing.T) {
+	workPool := NewWorkPool(0, 0, ConcurrencyCaps{})
+	for _, deadline := range []time.Time{time.Now().Add(time.Hour), time.Now().Add(-time.Minute), time.Now().Add(2 * time.Hour)} {
+		workPool.running[&queuedWork{id: uuid.NewV4(), deadline: deadline}] = true
+	}
+	for i := 0; i < 10; i++ {
+		if got := workPool.EstimatedWait(); got != 0 {
+			t.Fatalf("EstimatedWait with a bot past its deadline = %v, want 0", got)
+		}
+	}
+}